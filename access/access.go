@@ -0,0 +1,190 @@
+// Package access makes local access-control decisions for the credentials
+// read by Wiegand readers, so that a door can run stand-alone when a
+// central server is unreachable. An Engine checks each credential against
+// an Allowlist and returns a Decision, which it also passes to an audit
+// function:
+//
+//	allow, err := access.LoadFile("/etc/wiegandd/allowlist.json")
+//	...
+//	engine := access.New(access.Config{
+//		Allowlist: allow,
+//		Audit:     func(d access.Decision) { log.Println(d) },
+//	})
+//	reader, err := wiegand.New(ctx, wiegand.Config{
+//		Name: "front-door", D0Pin: "GPIO4", D1Pin: "GPIO17",
+//		CredentialCallback: engine.Callback(func(d access.Decision) {
+//			if d.Granted {
+//				// Unlock the door.
+//			}
+//		}),
+//	})
+//
+// The door a credential is checked against is the name of the Reader that
+// read it.
+package access
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+// Reason explains a Decision.
+type Reason int
+
+const (
+	// Granted means the card is valid for the door.
+	Granted Reason = iota
+	// UnknownCard means the card is not in the Allowlist.
+	UnknownCard
+	// Revoked means the card has been revoked.
+	Revoked
+	// NotYetValid means the card's NotBefore time has not been reached.
+	NotYetValid
+	// Expired means the card's NotAfter time has passed.
+	Expired
+	// DoorNotAllowed means the card does not open this door.
+	DoorNotAllowed
+	// OutsideSchedule means the card's schedule for this door does not
+	// grant access at this time.
+	OutsideSchedule
+)
+
+var reasonNames = [...]string{
+	Granted:         "granted",
+	UnknownCard:     "unknown_card",
+	Revoked:         "revoked",
+	NotYetValid:     "not_yet_valid",
+	Expired:         "expired",
+	DoorNotAllowed:  "door_not_allowed",
+	OutsideSchedule: "outside_schedule",
+}
+
+func (r Reason) String() string {
+	if r < 0 || int(r) >= len(reasonNames) {
+		return fmt.Sprintf("Reason(%d)", int(r))
+	}
+	return reasonNames[r]
+}
+
+// MarshalText encodes the Reason as its String, e.g. "unknown_card".
+func (r Reason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// Decision is the outcome of checking a credential.
+type Decision struct {
+	Granted    bool
+	Reason     Reason
+	Door       string // Name of the Reader the credential was read on
+	Holder     string // Name of the card holder, if the card is known
+	Credential wiegand.Credential
+	Time       time.Time // When the decision was made
+}
+
+// String returns a short description of the decision, e.g.
+// "front-door: 26-bit 15:54321 (J. Smith) denied: expired".
+func (d Decision) String() string {
+	s := fmt.Sprintf("%s: %s", d.Door, d.Credential)
+	if d.Holder != "" {
+		s += fmt.Sprintf(" (%s)", d.Holder)
+	}
+	if d.Granted {
+		return s + " granted"
+	}
+	return s + " denied: " + d.Reason.String()
+}
+
+// MarshalJSON encodes the decision as a flat audit record.
+func (d Decision) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time    time.Time `json:"time"`
+		Door    string    `json:"door"`
+		Format  string    `json:"format"`
+		Site    uint64    `json:"site"`
+		Tag     uint64    `json:"tag"`
+		Holder  string    `json:"holder,omitempty"`
+		Granted bool      `json:"granted"`
+		Reason  Reason    `json:"reason"`
+	}{d.Time, d.Door, d.Credential.Format, d.Credential.Site, d.Credential.Tag, d.Holder, d.Granted, d.Reason})
+}
+
+// Config holds configuration for creating an Engine.
+type Config struct {
+	Allowlist *Allowlist       // Cards to grant (default: an empty Allowlist, denying every card)
+	Audit     func(Decision)   // Called with every decision (optional)
+	Now       func() time.Time // Clock for validity windows and schedules (default time.Now)
+}
+
+// Engine decides whether credentials grant access. It is safe for
+// concurrent use.
+type Engine struct {
+	cfg Config
+}
+
+// New creates an Engine.
+func New(cfg Config) *Engine {
+	if cfg.Allowlist == nil {
+		cfg.Allowlist = NewAllowlist()
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Engine{cfg: cfg}
+}
+
+// Allowlist returns the Allowlist the Engine consults.
+func (e *Engine) Allowlist() *Allowlist {
+	return e.cfg.Allowlist
+}
+
+// Check decides whether a credential grants access to the door it was read
+// on, and passes the Decision to the audit function.
+func (e *Engine) Check(c wiegand.Credential) Decision {
+	d := Decision{Door: c.Reader, Credential: c, Time: e.cfg.Now()}
+	card, ok := e.cfg.Allowlist.Lookup(c.Format, c.Site, c.Tag)
+	if ok {
+		d.Holder = card.Name
+	}
+	switch {
+	case !ok:
+		d.Reason = UnknownCard
+	case card.Revoked:
+		d.Reason = Revoked
+	case !card.NotBefore.IsZero() && d.Time.Before(card.NotBefore):
+		d.Reason = NotYetValid
+	case !card.NotAfter.IsZero() && !d.Time.Before(card.NotAfter):
+		d.Reason = Expired
+	case len(card.Doors) > 0 && !slices.Contains(card.Doors, d.Door):
+		d.Reason = DoorNotAllowed
+	case !e.scheduled(card, d.Door, d.Time):
+		d.Reason = OutsideSchedule
+	default:
+		d.Granted, d.Reason = true, Granted
+	}
+	if e.cfg.Audit != nil {
+		e.cfg.Audit(d)
+	}
+	return d
+}
+
+// scheduled reports whether card's schedule for door, if it has one, grants
+// access at t.
+func (e *Engine) scheduled(card Card, door string, t time.Time) bool {
+	name, ok := card.schedule(door)
+	return !ok || e.cfg.Allowlist.allowedAt(name, t)
+}
+
+// Callback returns a function for wiegand.Config.CredentialCallback which
+// checks each credential and passes the Decision to fn.
+func (e *Engine) Callback(fn func(Decision)) func(wiegand.Credential) {
+	return func(c wiegand.Credential) {
+		d := e.Check(c)
+		if fn != nil {
+			fn(d)
+		}
+	}
+}
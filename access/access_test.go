@@ -0,0 +1,151 @@
+package access_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+	"github.com/asjoyner/wiegand-go/access"
+	"github.com/asjoyner/wiegand-go/wiegandtest"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestCheck(t *testing.T) {
+	allow := access.NewAllowlist(
+		access.Card{Site: 15, Tag: 1, Name: "anywhere"},
+		access.Card{Site: 15, Tag: 2, Name: "front only", Doors: []string{"front-door"}},
+		access.Card{Site: 15, Tag: 3, Name: "revoked", Revoked: true},
+		access.Card{Site: 15, Tag: 4, Name: "future", NotBefore: now.Add(time.Hour)},
+		access.Card{Site: 15, Tag: 5, Name: "expired", NotAfter: now},
+		access.Card{Site: 15, Tag: 6, Name: "current", NotBefore: now, NotAfter: now.Add(time.Hour)},
+		access.Card{Format: "26-bit", Site: 15, Tag: 7, Name: "26-bit only"},
+		access.Card{Format: "34-bit", Site: 15, Tag: 8, Name: "34-bit only", Revoked: true},
+		access.Card{Format: "26-bit", Site: 15, Tag: 8, Name: "26-bit only"},
+	)
+	var audited []access.Decision
+	engine := access.New(access.Config{
+		Allowlist: allow,
+		Audit:     func(d access.Decision) { audited = append(audited, d) },
+		Now:       func() time.Time { return now },
+	})
+	tests := []struct {
+		format    string
+		site, tag uint64
+		door      string
+		want      access.Reason
+	}{
+		{"26-bit", 15, 1, "back-door", access.Granted},
+		{"34-bit", 15, 1, "back-door", access.Granted},
+		{"26-bit", 15, 2, "front-door", access.Granted},
+		{"26-bit", 15, 2, "back-door", access.DoorNotAllowed},
+		{"26-bit", 15, 3, "front-door", access.Revoked},
+		{"26-bit", 15, 4, "front-door", access.NotYetValid},
+		{"26-bit", 15, 5, "front-door", access.Expired},
+		{"26-bit", 15, 6, "front-door", access.Granted},
+		{"26-bit", 16, 1, "front-door", access.UnknownCard},
+		{"26-bit", 15, 7, "front-door", access.Granted},
+		{"34-bit", 15, 7, "front-door", access.UnknownCard},
+		{"26-bit", 15, 8, "front-door", access.Granted},
+		{"34-bit", 15, 8, "front-door", access.Revoked},
+	}
+	for _, tt := range tests {
+		d := engine.Check(wiegand.Credential{Reader: tt.door, Format: tt.format, Site: tt.site, Tag: tt.tag})
+		if d.Reason != tt.want || d.Granted != (tt.want == access.Granted) {
+			t.Errorf("Check(%s %d:%d at %s) = %v, want %v", tt.format, tt.site, tt.tag, tt.door, d, tt.want)
+		}
+		if !d.Time.Equal(now) || d.Door != tt.door {
+			t.Errorf("Check(%s %d:%d at %s) time and door = %v, %q", tt.format, tt.site, tt.tag, tt.door, d.Time, d.Door)
+		}
+	}
+	if len(audited) != len(tests) {
+		t.Errorf("audited %d decisions, want %d", len(audited), len(tests))
+	}
+
+	allow.Revoke("", 15, 1)
+	if d := engine.Check(wiegand.Credential{Reader: "front-door", Site: 15, Tag: 1}); d.Reason != access.Revoked {
+		t.Errorf("Check() after Revoke() = %v, want revoked", d)
+	}
+	allow.Remove("", 15, 1)
+	if d := engine.Check(wiegand.Credential{Reader: "front-door", Site: 15, Tag: 1}); d.Reason != access.UnknownCard {
+		t.Errorf("Check() after Remove() = %v, want unknown_card", d)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	allow, err := access.Load(strings.NewReader(`[
+  {"site": 15, "tag": 54321, "name": "J. Smith", "doors": ["front-door"], "not_after": "2027-01-01T00:00:00Z"},
+  {"site": 15, "tag": 12345, "revoked": true}
+]`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	cards := allow.Cards()
+	if len(cards) != 2 || cards[0].Tag != 12345 || !cards[0].Revoked {
+		t.Fatalf("Cards() = %+v, want the revoked card first", cards)
+	}
+	c := cards[1]
+	if c.Name != "J. Smith" || len(c.Doors) != 1 || !c.NotAfter.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("loaded card = %+v", c)
+	}
+
+	if _, err := access.Load(strings.NewReader(`{"site": 1}`)); err == nil {
+		t.Error("Load() of an object succeeded, want error")
+	}
+}
+
+func TestDecisionJSON(t *testing.T) {
+	d := access.Decision{
+		Door:       "front-door",
+		Holder:     "J. Smith",
+		Reason:     access.Expired,
+		Credential: wiegand.Credential{Format: "26-bit", Site: 15, Tag: 54321},
+		Time:       now,
+	}
+	got, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `{"time":"2026-03-01T12:00:00Z","door":"front-door","format":"26-bit","site":15,"tag":54321,"holder":"J. Smith","granted":false,"reason":"expired"}`
+	if string(got) != want {
+		t.Errorf("Marshal() = %s, want %s", got, want)
+	}
+	if s := d.String(); s != "front-door: 26-bit 15:54321 (J. Smith) denied: expired" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestCallback(t *testing.T) {
+	line := wiegandtest.NewLine()
+	line.Interval = time.Millisecond
+	engine := access.New(access.Config{
+		Allowlist: access.NewAllowlist(access.Card{Site: 15, Tag: 54321}),
+	})
+	decisions := make(chan access.Decision, 1)
+	r, err := wiegand.New(context.Background(), wiegand.Config{
+		Name: "front-door", D0Pin: "D0", D1Pin: "D1", Backend: line,
+		Timeout:            20 * time.Millisecond,
+		CredentialCallback: engine.Callback(func(d access.Decision) { decisions <- d }),
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer r.Close()
+
+	for _, tag := range []uint64{54321, 54322} {
+		if err := line.SendFrame(wiegand.Format26, 15, tag); err != nil {
+			t.Fatalf("SendFrame() error = %v", err)
+		}
+		select {
+		case d := <-decisions:
+			if d.Granted != (tag == 54321) || d.Door != "front-door" {
+				t.Errorf("decision for tag %d = %v", tag, d)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no decision for tag %d", tag)
+		}
+	}
+}
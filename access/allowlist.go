@@ -0,0 +1,247 @@
+package access
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Card is an allowlist entry: a card identified by its site (facility) code
+// and tag, and when and where it grants access.
+type Card struct {
+	// Format is the name of the wiegand.Format the card is read with, such
+	// as "26-bit". The same site and tag in another format is a different
+	// card. Empty matches the card read in any format without an entry of
+	// its own.
+	Format string `json:"format,omitempty"`
+	Site   uint64 `json:"site"`
+	Tag    uint64 `json:"tag"`
+	Name   string `json:"name,omitempty"` // Card holder, for audit events
+	// Doors lists the names of the Readers the card opens. Empty means
+	// every door.
+	Doors []string `json:"doors,omitempty"`
+	// NotBefore and NotAfter bound the card's validity: it is valid from
+	// NotBefore up to, but not including, NotAfter. A zero time leaves
+	// that end open.
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	Revoked   bool      `json:"revoked,omitempty"`
+	// Schedules restricts when the card grants access, mapping a door name
+	// to the name of a Schedule set on the Allowlist. The door "*" applies
+	// to doors without their own entry. A door without a schedule is open
+	// to the card at any time.
+	Schedules map[string]string `json:"schedules,omitempty"`
+}
+
+// schedule returns the name of the schedule for door, if any.
+func (c Card) schedule(door string) (string, bool) {
+	if name, ok := c.Schedules[door]; ok {
+		return name, true
+	}
+	name, ok := c.Schedules["*"]
+	return name, ok
+}
+
+// cardKey identifies a card.
+type cardKey struct {
+	format    string
+	site, tag uint64
+}
+
+func (c Card) key() cardKey { return cardKey{c.Format, c.Site, c.Tag} }
+
+// Allowlist is a set of Cards, with the Schedules and holiday Calendars
+// they refer to. It is safe for concurrent use, so that it can be updated
+// while an Engine consults it.
+type Allowlist struct {
+	mu        sync.RWMutex
+	cards     map[cardKey]Card
+	schedules map[string]Schedule
+	calendars map[string]map[Date]bool
+}
+
+// NewAllowlist creates an Allowlist holding cards. A later card replaces an
+// earlier one with the same format, site and tag.
+func NewAllowlist(cards ...Card) *Allowlist {
+	a := &Allowlist{
+		cards:     make(map[cardKey]Card, len(cards)),
+		schedules: make(map[string]Schedule),
+		calendars: make(map[string]map[Date]bool),
+	}
+	for _, c := range cards {
+		a.cards[c.key()] = c
+	}
+	return a
+}
+
+// allowlistFile is the JSON form of an Allowlist with schedules.
+type allowlistFile struct {
+	Cards     []Card              `json:"cards"`
+	Schedules map[string]Schedule `json:"schedules"`
+	Calendars map[string]Calendar `json:"calendars"`
+}
+
+// Load reads an Allowlist from JSON: either an array of Cards, e.g.
+//
+//	[{"format": "26-bit", "site": 15, "tag": 54321, "name": "J. Smith", "doors": ["front-door"],
+//	  "not_after": "2027-01-01T00:00:00Z"}]
+//
+// or an object holding the cards with the schedules and holiday calendars
+// they use:
+//
+//	{"cards": [{"site": 15, "tag": 54321, "schedules": {"*": "office"}}],
+//	 "schedules": {"office": {"time_zone": "Europe/London", "holidays": ["uk"],
+//	   "windows": [{"days": ["mon", "tue", "wed", "thu", "fri"], "start": "08:00", "end": "18:00"}]}},
+//	 "calendars": {"uk": ["2026-12-25", "2026-12-28"]}}
+//
+// Every schedule and calendar referred to must be defined.
+func Load(r io.Reader) (*Allowlist, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("reading allowlist: %w", err)
+	}
+	var f allowlistFile
+	var v any = &f
+	if raw[0] == '[' {
+		v = &f.Cards
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return nil, fmt.Errorf("reading allowlist: %w", err)
+	}
+	a := NewAllowlist(f.Cards...)
+	for name, c := range f.Calendars {
+		a.SetCalendar(name, c)
+	}
+	for name, s := range f.Schedules {
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", name, err)
+		}
+		for _, cal := range s.Holidays {
+			if _, ok := f.Calendars[cal]; !ok {
+				return nil, fmt.Errorf("schedule %q: unknown calendar %q", name, cal)
+			}
+		}
+		a.SetSchedule(name, s)
+	}
+	for _, c := range f.Cards {
+		for door, name := range c.Schedules {
+			if _, ok := f.Schedules[name]; !ok {
+				return nil, fmt.Errorf("card %d:%d: unknown schedule %q for door %q", c.Site, c.Tag, name, door)
+			}
+		}
+	}
+	return a, nil
+}
+
+// LoadFile reads an Allowlist from a JSON file, as described for Load.
+func LoadFile(name string) (*Allowlist, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Add adds a card, replacing any card with the same format, site and tag.
+func (a *Allowlist) Add(c Card) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cards[c.key()] = c
+}
+
+// Remove deletes the card with the given format, site and tag, reporting
+// whether it was present. A removed card is denied as unknown; use Revoke to
+// keep a record of it.
+func (a *Allowlist) Remove(format string, site, tag uint64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	k := cardKey{format, site, tag}
+	_, ok := a.cards[k]
+	delete(a.cards, k)
+	return ok
+}
+
+// Revoke marks the card with the given format, site and tag revoked,
+// reporting whether it was present.
+func (a *Allowlist) Revoke(format string, site, tag uint64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	k := cardKey{format, site, tag}
+	c, ok := a.cards[k]
+	if ok {
+		c.Revoked = true
+		a.cards[k] = c
+	}
+	return ok
+}
+
+// Replace replaces every card, for example with a fresh copy from a central
+// server. Schedules and calendars are kept.
+func (a *Allowlist) Replace(cards []Card) {
+	n := NewAllowlist(cards...)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cards = n.cards
+}
+
+// SetSchedule defines or replaces a named Schedule. Cards referring to a
+// schedule which is not defined are denied.
+func (a *Allowlist) SetSchedule(name string, s Schedule) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.schedules[name] = s
+}
+
+// SetCalendar defines or replaces a named holiday Calendar.
+func (a *Allowlist) SetCalendar(name string, c Calendar) {
+	dates := make(map[Date]bool, len(c))
+	for _, d := range c {
+		dates[d] = true
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calendars[name] = dates
+}
+
+// allowedAt reports whether the schedule named name grants access at t.
+func (a *Allowlist) allowedAt(name string, t time.Time) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	s, ok := a.schedules[name]
+	return ok && s.allows(t, func(cal string, d Date) bool { return a.calendars[cal][d] })
+}
+
+// Lookup returns the card read in format with the given site and tag: the
+// card for that format if there is one, otherwise a card without a format.
+func (a *Allowlist) Lookup(format string, site, tag uint64) (Card, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if c, ok := a.cards[cardKey{format, site, tag}]; ok {
+		return c, true
+	}
+	c, ok := a.cards[cardKey{"", site, tag}]
+	return c, ok
+}
+
+// Cards returns every card, ordered by site, tag and format.
+func (a *Allowlist) Cards() []Card {
+	a.mu.RLock()
+	cards := make([]Card, 0, len(a.cards))
+	for _, c := range a.cards {
+		cards = append(cards, c)
+	}
+	a.mu.RUnlock()
+	slices.SortFunc(cards, func(x, y Card) int {
+		return cmp.Or(cmp.Compare(x.Site, y.Site), cmp.Compare(x.Tag, y.Tag), cmp.Compare(x.Format, y.Format))
+	})
+	return cards
+}
@@ -0,0 +1,210 @@
+package access
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Day is a day of the week, or Holiday. Its text form is "sun" to "sat" or
+// "holiday".
+type Day int
+
+// Holiday is the Day of a date listed in one of a Schedule's holiday
+// calendars. Such a date only matches Windows listing Holiday, not its
+// weekday.
+const Holiday = Day(7)
+
+var dayNames = [...]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat", "holiday"}
+
+// Weekday returns the Day of a weekday.
+func Weekday(d time.Weekday) Day { return Day(d) }
+
+func (d Day) String() string {
+	if d < 0 || int(d) >= len(dayNames) {
+		return fmt.Sprintf("Day(%d)", int(d))
+	}
+	return dayNames[d]
+}
+
+func (d Day) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Day) UnmarshalText(text []byte) error {
+	i := slices.Index(dayNames[:], strings.ToLower(string(text)))
+	if i < 0 {
+		return fmt.Errorf("unknown day %q", text)
+	}
+	*d = Day(i)
+	return nil
+}
+
+// TimeOfDay is a wall-clock time, in minutes after midnight. Its text form
+// is "15:04"; "24:00" is the end of the day.
+type TimeOfDay int
+
+// Clock returns the TimeOfDay of hour and minute.
+func Clock(hour, min int) TimeOfDay { return TimeOfDay(hour*60 + min) }
+
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t/60, t%60)
+}
+
+func (t TimeOfDay) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *TimeOfDay) UnmarshalText(text []byte) error {
+	var h, m int
+	if n, err := fmt.Sscanf(string(text), "%d:%d", &h, &m); err != nil || n != 2 || len(text) != 5 ||
+		h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return fmt.Errorf("invalid time of day %q, want HH:MM", text)
+	}
+	*t = Clock(h, m)
+	return nil
+}
+
+// Date is a calendar date. Its text form is "2006-01-02".
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// DateOf returns the date of t in t's location.
+func DateOf(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{y, m, d}
+}
+
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Date) UnmarshalText(text []byte) error {
+	t, err := time.Parse(time.DateOnly, string(text))
+	if err != nil {
+		return fmt.Errorf("invalid date %q, want YYYY-MM-DD", text)
+	}
+	*d = DateOf(t)
+	return nil
+}
+
+// addDays returns the date n days after d.
+func (d Date) addDays(n int) Date {
+	return DateOf(time.Date(d.Year, d.Month, d.Day+n, 12, 0, 0, 0, time.UTC))
+}
+
+// weekday returns the day of the week of d.
+func (d Date) weekday() time.Weekday {
+	return time.Date(d.Year, d.Month, d.Day, 12, 0, 0, 0, time.UTC).Weekday()
+}
+
+// Calendar is a set of dates, such as public holidays.
+type Calendar []Date
+
+// TimeZone is a time zone for a Schedule. Its text form is an IANA time
+// zone name such as "America/New_York", or empty for a nil Location, which
+// is the local time zone of the system.
+type TimeZone struct {
+	*time.Location
+}
+
+func (z TimeZone) MarshalText() ([]byte, error) {
+	if z.Location == nil {
+		return nil, nil
+	}
+	return []byte(z.String()), nil
+}
+
+func (z *TimeZone) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		z.Location = nil
+		return nil
+	}
+	loc, err := time.LoadLocation(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid time zone: %w", err)
+	}
+	z.Location = loc
+	return nil
+}
+
+// Window is a recurring period during which a Schedule grants access: from
+// Start until End on each of Days. If End is not after Start the window
+// runs overnight, until End on the following day. Times are compared on the
+// wall clock of the Schedule's time zone, so a window keeps its hours across
+// daylight saving time changes; a wall-clock time skipped by a change never
+// occurs, and one repeated by a change matches both times.
+type Window struct {
+	Days  []Day     `json:"days"`
+	Start TimeOfDay `json:"start"`
+	End   TimeOfDay `json:"end"`
+}
+
+// Schedule restricts when a Card grants access.
+type Schedule struct {
+	// TimeZone is the time zone of the Windows (default: the local time
+	// zone of the system).
+	TimeZone TimeZone `json:"time_zone"`
+	Windows  []Window `json:"windows"`
+	// Holidays names Calendars, set on the Allowlist, whose dates are
+	// holidays for this schedule.
+	Holidays []string `json:"holidays,omitempty"`
+}
+
+// allows reports whether the schedule grants access at t. holiday reports
+// whether a date is in one of the named calendars.
+func (s Schedule) allows(t time.Time, holiday func(name string, d Date) bool) bool {
+	loc := s.TimeZone.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	local := t.In(loc)
+	today := DateOf(local)
+	now := Clock(local.Hour(), local.Minute())
+	dayOf := func(d Date) Day {
+		for _, name := range s.Holidays {
+			if holiday(name, d) {
+				return Holiday
+			}
+		}
+		return Weekday(d.weekday())
+	}
+	for _, w := range s.Windows {
+		if w.Start < w.End {
+			if now >= w.Start && now < w.End && slices.Contains(w.Days, dayOf(today)) {
+				return true
+			}
+			continue
+		}
+		// Overnight: the part from Start to midnight belongs to today, and
+		// the part from midnight to End to a window starting yesterday.
+		if now >= w.Start && slices.Contains(w.Days, dayOf(today)) {
+			return true
+		}
+		if now < w.End && slices.Contains(w.Days, dayOf(today.addDays(-1))) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the schedule's windows.
+func (s Schedule) validate() error {
+	for i, w := range s.Windows {
+		if len(w.Days) == 0 {
+			return fmt.Errorf("window %d has no days", i)
+		}
+		if w.Start >= 24*60 {
+			return fmt.Errorf("window %d starts at %v, after the end of the day", i, w.Start)
+		}
+	}
+	return nil
+}
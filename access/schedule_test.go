@@ -0,0 +1,165 @@
+package access_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // Tests must not depend on the system's zone files
+
+	"github.com/asjoyner/wiegand-go"
+	"github.com/asjoyner/wiegand-go/access"
+)
+
+const scheduleJSON = `{
+  "cards": [
+    {"site": 1, "tag": 1, "name": "office hours", "schedules": {"*": "office"}},
+    {"site": 1, "tag": 2, "name": "night shift", "schedules": {"front-door": "night"}},
+    {"site": 1, "tag": 3, "name": "early sunday", "schedules": {"*": "sunday"}}
+  ],
+  "schedules": {
+    "office": {
+      "time_zone": "America/New_York",
+      "holidays": ["us"],
+      "windows": [
+        {"days": ["mon", "tue", "wed", "thu", "fri"], "start": "09:00", "end": "17:00"},
+        {"days": ["holiday"], "start": "10:00", "end": "12:00"}
+      ]
+    },
+    "night": {
+      "time_zone": "America/New_York",
+      "holidays": ["us"],
+      "windows": [{"days": ["fri"], "start": "22:00", "end": "06:00"}]
+    },
+    "sunday": {
+      "time_zone": "America/New_York",
+      "windows": [{"days": ["sun"], "start": "01:00", "end": "03:00"}]
+    }
+  },
+  "calendars": {"us": ["2026-12-25"]}
+}`
+
+func TestSchedules(t *testing.T) {
+	allow, err := access.Load(strings.NewReader(scheduleJSON))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var now time.Time
+	engine := access.New(access.Config{Allowlist: allow, Now: func() time.Time { return now }})
+	utc := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	// New York changes from EST (UTC-5) to EDT (UTC-4) at 02:00 on 8 March
+	// 2026, and back at 02:00 on 1 November.
+	tests := []struct {
+		desc string
+		tag  uint64
+		door string
+		at   time.Time
+		want bool
+	}{
+		{"Friday 08:30 EST", 1, "front-door", utc(time.March, 6, 13, 30), false},
+		{"Friday 09:30 EST", 1, "front-door", utc(time.March, 6, 14, 30), true},
+		{"Monday 09:30 EDT", 1, "front-door", utc(time.March, 9, 13, 30), true},
+		{"Monday 17:00 EDT", 1, "front-door", utc(time.March, 9, 21, 0), false},
+		{"Saturday 12:00", 1, "front-door", utc(time.March, 7, 17, 0), false},
+
+		{"spring forward 01:30 EST", 3, "front-door", utc(time.March, 8, 6, 30), true},
+		{"spring forward 03:00 EDT", 3, "front-door", utc(time.March, 8, 7, 0), false},
+		{"fall back first 01:30 EDT", 3, "front-door", utc(time.November, 1, 5, 30), true},
+		{"fall back second 01:30 EST", 3, "front-door", utc(time.November, 1, 6, 30), true},
+		{"fall back 02:30 EST", 3, "front-door", utc(time.November, 1, 7, 30), true},
+		{"fall back 03:00 EST", 3, "front-door", utc(time.November, 1, 8, 0), false},
+
+		{"Friday 23:00", 2, "front-door", utc(time.March, 7, 4, 0), true},
+		{"Saturday 05:00, overnight from Friday", 2, "front-door", utc(time.March, 7, 10, 0), true},
+		{"Saturday 07:00", 2, "front-door", utc(time.March, 7, 12, 0), false},
+		{"Saturday 23:00", 2, "front-door", utc(time.March, 8, 4, 0), false},
+		{"door without a schedule", 2, "back-door", utc(time.March, 8, 4, 0), true},
+
+		{"holiday Friday 09:30", 1, "front-door", utc(time.December, 25, 14, 30), false},
+		{"holiday Friday 10:30", 1, "front-door", utc(time.December, 25, 15, 30), true},
+		{"holiday Friday 23:00", 2, "front-door", utc(time.December, 26, 4, 0), false},
+		{"Saturday 05:00 after the holiday", 2, "front-door", utc(time.December, 26, 10, 0), false},
+	}
+	for _, tt := range tests {
+		now = tt.at
+		d := engine.Check(wiegand.Credential{Reader: tt.door, Site: 1, Tag: tt.tag})
+		if d.Granted != tt.want {
+			t.Errorf("%s: Check(tag %d at %s) = %v, want granted %v", tt.desc, tt.tag, tt.door, d, tt.want)
+		}
+		if !d.Granted && d.Reason != access.OutsideSchedule {
+			t.Errorf("%s: reason = %v, want outside_schedule", tt.desc, d.Reason)
+		}
+	}
+
+	// A card referring to a schedule which does not exist is denied.
+	allow.Add(access.Card{Site: 1, Tag: 4, Schedules: map[string]string{"*": "missing"}})
+	if d := engine.Check(wiegand.Credential{Reader: "front-door", Site: 1, Tag: 4}); d.Granted {
+		t.Errorf("Check() with a missing schedule = %v, want denied", d)
+	}
+}
+
+func TestScheduleWholeDay(t *testing.T) {
+	allow := access.NewAllowlist(access.Card{Site: 1, Tag: 1, Schedules: map[string]string{"*": "weekend"}})
+	allow.SetSchedule("weekend", access.Schedule{
+		TimeZone: access.TimeZone{Location: time.UTC},
+		Windows: []access.Window{
+			{Days: []access.Day{access.Weekday(time.Saturday), access.Weekday(time.Sunday)}, Start: access.Clock(0, 0), End: access.Clock(24, 0)},
+		},
+	})
+	var now time.Time
+	engine := access.New(access.Config{Allowlist: allow, Now: func() time.Time { return now }})
+	for _, tt := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC), true},    // Saturday
+		{time.Date(2026, 3, 8, 23, 59, 59, 0, time.UTC), true}, // Sunday
+		{time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC), false},   // Monday
+	} {
+		now = tt.at
+		if d := engine.Check(wiegand.Credential{Site: 1, Tag: 1}); d.Granted != tt.want {
+			t.Errorf("Check() at %v = %v, want granted %v", tt.at, d, tt.want)
+		}
+	}
+}
+
+func TestTimeZoneText(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, loc := range []*time.Location{nil, time.Local, time.UTC, london} {
+		text, err := access.TimeZone{Location: loc}.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText(%v) error = %v", loc, err)
+		}
+		var z access.TimeZone
+		if err := z.UnmarshalText(text); err != nil {
+			t.Fatalf("UnmarshalText(%q) error = %v", text, err)
+		}
+		if (z.Location == nil) != (loc == nil) || (loc != nil && z.String() != loc.String()) {
+			t.Errorf("UnmarshalText(%q) = %v, want %v", text, z.Location, loc)
+		}
+	}
+}
+
+func TestLoadScheduleErrors(t *testing.T) {
+	tests := []struct {
+		data, want string
+	}{
+		{`{"schedules": {"s": {"windows": [{"days": ["mon"], "start": "25:00", "end": "26:00"}]}}}`, "invalid time of day"},
+		{`{"schedules": {"s": {"windows": [{"days": ["someday"], "start": "09:00", "end": "17:00"}]}}}`, `unknown day "someday"`},
+		{`{"schedules": {"s": {"windows": [{"start": "09:00", "end": "17:00"}]}}}`, "window 0 has no days"},
+		{`{"schedules": {"s": {"time_zone": "Mars/Olympus_Mons", "windows": []}}}`, "invalid time zone"},
+		{`{"schedules": {"s": {"holidays": ["xmas"], "windows": []}}}`, `unknown calendar "xmas"`},
+		{`{"cards": [{"site": 1, "tag": 2, "schedules": {"*": "s"}}]}`, `card 1:2: unknown schedule "s"`},
+		{`{"calendars": {"c": ["25/12/2026"]}}`, "invalid date"},
+	}
+	for _, tt := range tests {
+		_, err := access.Load(strings.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Load(%s) error = %v, want %q", tt.data, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+//go:build linux
+
+package wiegand
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// Definitions from the GPIO character device v2 uAPI in <linux/gpio.h>.
+const (
+	gpioV2LineFlagInput              = 1 << 2
+	gpioV2LineFlagEdgeRising         = 1 << 4
+	gpioV2LineFlagEdgeFalling        = 1 << 5
+	gpioV2LineFlagBiasPullDown       = 1 << 9
+	gpioV2LineFlagEventClockRealtime = 1 << 11
+
+	gpioV2LineEventRisingEdge  = 1
+	gpioV2LineEventFallingEdge = 2
+
+	gpioGetChipInfoIoctl   = 0x8044b401 // _IOR(0xB4, 0x01, struct gpiochip_info)
+	gpioV2GetLineInfoIoctl = 0xc100b405 // _IOWR(0xB4, 0x05, struct gpio_v2_line_info)
+	gpioV2GetLineIoctl     = 0xc250b407 // _IOWR(0xB4, 0x07, struct gpio_v2_line_request)
+
+	gpioV2LineEventSize = 48 // sizeof(struct gpio_v2_line_event)
+)
+
+type gpioChipInfo struct {
+	Name  [32]byte
+	Label [32]byte
+	Lines uint32
+}
+
+type gpioV2LineAttribute struct {
+	ID      uint32
+	Padding uint32
+	Value   uint64
+}
+
+type gpioV2LineConfigAttribute struct {
+	Attr gpioV2LineAttribute
+	Mask uint64
+}
+
+type gpioV2LineConfig struct {
+	Flags    uint64
+	NumAttrs uint32
+	Padding  [5]uint32
+	Attrs    [10]gpioV2LineConfigAttribute
+}
+
+type gpioV2LineRequest struct {
+	Offsets         [64]uint32
+	Consumer        [32]byte
+	Config          gpioV2LineConfig
+	NumLines        uint32
+	EventBufferSize uint32
+	Padding         [5]uint32
+	Fd              int32
+}
+
+type gpioV2LineInfo struct {
+	Name     [32]byte
+	Consumer [32]byte
+	Offset   uint32
+	NumAttrs uint32
+	Flags    uint64
+	Attrs    [10]gpioV2LineAttribute
+	Padding  [4]uint32
+}
+
+// DefaultChip is the GPIO character device used when CdevBackend.Chip is empty.
+const DefaultChip = "/dev/gpiochip0"
+
+// CdevBackend opens lines through the Linux GPIO character device (v2 uAPI).
+// Edges carry kernel timestamps taken in the interrupt handler, and lines
+// opened together with OpenPair share one request, so their sequence numbers
+// give the exact order of edges across D0 and D1.
+//
+// Lines are named by offset ("17") or by the name the chip's driver gives
+// them ("GPIO17" on a Raspberry Pi).
+type CdevBackend struct {
+	Chip     string // Path of the GPIO chip (default DefaultChip)
+	Consumer string // Label shown for the claimed lines (default "wiegand")
+}
+
+// ReportsEdgeDirection returns true: the kernel reports the direction of
+// each edge.
+func (CdevBackend) ReportsEdgeDirection() bool { return true }
+
+// Open requests a single line as a pulled-down input detecting edge.
+func (b CdevBackend) Open(name string, edge gpio.Edge) (EdgeSource, error) {
+	lines, err := b.request([]string{name}, edge)
+	if err != nil {
+		return nil, err
+	}
+	return lines[0], nil
+}
+
+// OpenPair requests the D0 and D1 lines together as pulled-down inputs
+// detecting edge.
+func (b CdevBackend) OpenPair(d0, d1 string, edge gpio.Edge) (EdgeSource, EdgeSource, error) {
+	lines, err := b.request([]string{d0, d1}, edge)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lines[0], lines[1], nil
+}
+
+// request claims the named lines in a single line request.
+func (b CdevBackend) request(names []string, edge gpio.Edge) ([]*cdevLine, error) {
+	path, consumer := b.Chip, b.Consumer
+	if path == "" {
+		path = DefaultChip
+	}
+	if consumer == "" {
+		consumer = "wiegand"
+	}
+	chip, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer chip.Close()
+
+	var req gpioV2LineRequest
+	for i, name := range names {
+		offset, err := lineOffset(chip, name)
+		if err != nil {
+			return nil, err
+		}
+		req.Offsets[i] = offset
+	}
+	req.NumLines = uint32(len(names))
+	copy(req.Consumer[:len(req.Consumer)-1], consumer)
+	req.Config.Flags = gpioV2LineFlagInput | gpioV2LineFlagBiasPullDown | gpioV2LineFlagEventClockRealtime
+	switch edge {
+	case gpio.RisingEdge:
+		req.Config.Flags |= gpioV2LineFlagEdgeRising
+	case gpio.FallingEdge:
+		req.Config.Flags |= gpioV2LineFlagEdgeFalling
+	case gpio.BothEdges:
+		req.Config.Flags |= gpioV2LineFlagEdgeRising | gpioV2LineFlagEdgeFalling
+	default:
+		return nil, fmt.Errorf("unsupported edge %v", edge)
+	}
+	if err := ioctl(chip.Fd(), gpioV2GetLineIoctl, unsafe.Pointer(&req)); err != nil {
+		return nil, fmt.Errorf("line request on %s: %w", path, err)
+	}
+
+	// A non-blocking descriptor is pollable, so closing it unblocks reads.
+	fd := int(req.Fd)
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), path+" lines")
+	return newCdevRequest(f, req.Offsets[:len(names)]), nil
+}
+
+// lineOffset resolves a line name or decimal offset on chip.
+func lineOffset(chip *os.File, name string) (uint32, error) {
+	if n, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(n), nil
+	}
+	var info gpioChipInfo
+	if err := ioctl(chip.Fd(), gpioGetChipInfoIoctl, unsafe.Pointer(&info)); err != nil {
+		return 0, fmt.Errorf("chip info: %w", err)
+	}
+	for offset := uint32(0); offset < info.Lines; offset++ {
+		line := gpioV2LineInfo{Offset: offset}
+		if err := ioctl(chip.Fd(), gpioV2GetLineInfoIoctl, unsafe.Pointer(&line)); err != nil {
+			return 0, fmt.Errorf("line %d info: %w", offset, err)
+		}
+		if string(bytes.TrimRight(line.Name[:], "\x00")) == name {
+			return offset, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownLine, name)
+}
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// cdevRequest reads the events of a line request and hands them to the
+// cdevLine for each requested offset.
+type cdevRequest struct {
+	f     io.ReadCloser
+	group uint64 // Edge.SeqGroup of the request's edges
+	lines map[uint32]*cdevLine
+	done  chan struct{} // Closed when the event reader exits
+	err   error         // Why the event reader exited, set before done is closed
+
+	mu   sync.Mutex
+	open int // Lines not yet closed; the request is released at zero
+}
+
+// cdevRequests numbers line requests, so that the sequence numbers of
+// separate requests are never compared.
+var cdevRequests atomic.Uint64
+
+// newCdevRequest starts reading line events from f, which is closed once
+// every returned line has been closed.
+func newCdevRequest(f io.ReadCloser, offsets []uint32) []*cdevLine {
+	r := &cdevRequest{
+		f:     f,
+		group: cdevRequests.Add(1),
+		lines: make(map[uint32]*cdevLine),
+		done:  make(chan struct{}),
+		open:  len(offsets),
+	}
+	lines := make([]*cdevLine, len(offsets))
+	for i, offset := range offsets {
+		lines[i] = &cdevLine{req: r, edges: make(chan Edge, 64), closed: make(chan struct{})}
+		r.lines[offset] = lines[i]
+	}
+	go r.readEvents()
+	return lines
+}
+
+// readEvents decodes struct gpio_v2_line_event records until f fails.
+func (r *cdevRequest) readEvents() {
+	defer close(r.done)
+	var buf [gpioV2LineEventSize]byte
+	for {
+		if _, err := io.ReadFull(r.f, buf[:]); err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				err = ErrClosed
+			}
+			r.err = err
+			return
+		}
+		var (
+			timestamp = binary.NativeEndian.Uint64(buf[0:])
+			id        = binary.NativeEndian.Uint32(buf[8:])
+			offset    = binary.NativeEndian.Uint32(buf[12:])
+			seqno     = binary.NativeEndian.Uint32(buf[16:])
+		)
+		line, ok := r.lines[offset]
+		if !ok || (id != gpioV2LineEventRisingEdge && id != gpioV2LineEventFallingEdge) {
+			continue
+		}
+		select {
+		case line.edges <- Edge{Time: time.Unix(0, int64(timestamp)), Rising: id == gpioV2LineEventRisingEdge, Seq: uint64(seqno), SeqGroup: r.group}:
+		case <-line.closed:
+		}
+	}
+}
+
+// release closes the request once its last line is closed.
+func (r *cdevRequest) release() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.open--
+	if r.open == 0 {
+		return r.f.Close()
+	}
+	return nil
+}
+
+// cdevLine is the EdgeSource for one line of a cdevRequest.
+type cdevLine struct {
+	req    *cdevRequest
+	edges  chan Edge
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (l *cdevLine) WaitForEdge(timeout time.Duration) (Edge, bool, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case e := <-l.edges:
+		return e, true, nil
+	case <-l.closed:
+		return Edge{}, false, ErrClosed
+	case <-l.req.done:
+		select {
+		case e := <-l.edges:
+			return e, true, nil
+		default:
+		}
+		return Edge{}, false, l.req.err
+	case <-timer.C:
+		return Edge{}, false, nil
+	}
+}
+
+func (l *cdevLine) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.closed)
+		err = l.req.release()
+	})
+	return err
+}
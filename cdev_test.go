@@ -0,0 +1,129 @@
+//go:build linux
+
+package wiegand
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+func TestCdevStructSizes(t *testing.T) {
+	tests := []struct {
+		name string
+		got  uintptr
+		want uintptr
+	}{
+		{"gpiochip_info", unsafe.Sizeof(gpioChipInfo{}), 68},
+		{"gpio_v2_line_info", unsafe.Sizeof(gpioV2LineInfo{}), 256},
+		{"gpio_v2_line_request", unsafe.Sizeof(gpioV2LineRequest{}), 592},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("sizeof(%s) = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+// lineEvent encodes a struct gpio_v2_line_event.
+func lineEvent(ts time.Time, id, offset, seqno uint32) []byte {
+	buf := make([]byte, gpioV2LineEventSize)
+	binary.NativeEndian.PutUint64(buf[0:], uint64(ts.UnixNano()))
+	binary.NativeEndian.PutUint32(buf[8:], id)
+	binary.NativeEndian.PutUint32(buf[12:], offset)
+	binary.NativeEndian.PutUint32(buf[16:], seqno)
+	return buf
+}
+
+func TestCdevRequestEvents(t *testing.T) {
+	pr, pw := io.Pipe()
+	lines := newCdevRequest(pr, []uint32{4, 17})
+	d0, d1 := lines[0], lines[1]
+
+	start := time.Unix(1700000000, 0)
+	go func() {
+		pw.Write(lineEvent(start, gpioV2LineEventFallingEdge, 17, 1))
+		pw.Write(lineEvent(start.Add(time.Millisecond), gpioV2LineEventFallingEdge, 4, 2))
+		pw.Write(lineEvent(start.Add(2*time.Millisecond), gpioV2LineEventFallingEdge, 99, 3))
+	}()
+
+	e, ok, err := d1.WaitForEdge(time.Second)
+	if err != nil || !ok || !e.Time.Equal(start) || e.Seq != 1 || e.SeqGroup == 0 {
+		t.Errorf("D1 WaitForEdge() = %+v, %v, %v, want edge 1 at %v", e, ok, err, start)
+	}
+	group := e.SeqGroup
+	e, ok, err = d0.WaitForEdge(time.Second)
+	if err != nil || !ok || e.Seq != 2 || e.SeqGroup != group {
+		t.Errorf("D0 WaitForEdge() = %+v, %v, %v, want edge 2 of sequence %d", e, ok, err, group)
+	}
+	other := newCdevRequest(io.NopCloser(strings.NewReader("")), []uint32{4})[0]
+	defer other.Close()
+	if other.req.group == group {
+		t.Errorf("second request has sequence %d, want one of its own", group)
+	}
+	if _, ok, err := d0.WaitForEdge(10 * time.Millisecond); ok || err != nil {
+		t.Errorf("D0 WaitForEdge() = %v, %v, want timeout (event for unrequested offset)", ok, err)
+	}
+
+	d0.Close()
+	if _, _, err := d0.WaitForEdge(time.Second); !errors.Is(err, ErrClosed) {
+		t.Errorf("WaitForEdge() after Close = %v, want ErrClosed", err)
+	}
+	// The request stays open until its last line is closed.
+	go pw.Write(lineEvent(start, gpioV2LineEventFallingEdge, 17, 4))
+	if e, ok, _ := d1.WaitForEdge(time.Second); !ok || e.Seq != 4 {
+		t.Errorf("D1 WaitForEdge() = %+v, %v, want edge 4", e, ok)
+	}
+	d1.Close()
+	if _, err := pw.Write(lineEvent(start, gpioV2LineEventFallingEdge, 17, 5)); err == nil {
+		t.Error("request still being read after both lines were closed")
+	}
+}
+
+func TestCdevRequestFailure(t *testing.T) {
+	pr, pw := io.Pipe()
+	lines := newCdevRequest(pr, []uint32{1})
+	pw.CloseWithError(errors.New("device gone"))
+	if _, _, err := lines[0].WaitForEdge(time.Second); err == nil || err.Error() != "device gone" {
+		t.Errorf("WaitForEdge() error = %v, want device gone", err)
+	}
+}
+
+// TestCdevGPIOSim exercises CdevBackend against the gpio-sim kernel module.
+// Set WIEGAND_GPIOSIM_CHIP to the simulated chip's device (e.g.
+// /dev/gpiochip1) and WIEGAND_GPIOSIM_SYSFS to its sysfs directory (e.g.
+// /sys/devices/platform/gpio-sim.0/gpiochip1); lines 0 and 1 are used.
+func TestCdevGPIOSim(t *testing.T) {
+	chip, sysfs := os.Getenv("WIEGAND_GPIOSIM_CHIP"), os.Getenv("WIEGAND_GPIOSIM_SYSFS")
+	if chip == "" || sysfs == "" {
+		t.Skip("WIEGAND_GPIOSIM_CHIP and WIEGAND_GPIOSIM_SYSFS not set")
+	}
+	pull := func(line, value string) {
+		if err := os.WriteFile(sysfs+"/sim_gpio"+line+"/pull", []byte(value), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pull("0", "pull-up")
+	pull("1", "pull-up")
+	d0, d1, err := CdevBackend{Chip: chip}.OpenPair("0", "1", gpio.FallingEdge)
+	if err != nil {
+		t.Fatalf("OpenPair() error = %v", err)
+	}
+	defer d0.Close()
+	defer d1.Close()
+
+	pull("1", "pull-down")
+	pull("0", "pull-down")
+	e1, ok1, _ := d1.WaitForEdge(time.Second)
+	e0, ok0, _ := d0.WaitForEdge(time.Second)
+	if !ok0 || !ok1 || e1.Seq >= e0.Seq {
+		t.Errorf("got D1 edge %+v (%v) and D0 edge %+v (%v), want D1 first", e1, ok1, e0, ok0)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,76 +13,36 @@ import (
 )
 
 func main() {
-	// Create context for cancellation
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Define callback to receive Wiegand data
-	callback := func(site, tag string) {
-		fmt.Printf("Received Wiegand data: site: %s, tag: %s\n", site, tag)
-	}
-
-	reader1, err := wiegand.New(ctx, wiegand.Config{
-		D0Pin:    "GPIO4",  // Wiegand D0 (e.g., green wire)
-		D1Pin:    "GPIO17", // Wiegand D1 (e.g., white wire)
-		Callback: callback,
-		Timeout:  100 * time.Millisecond,
-		MaxBits:  26,
-	})
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize Wiegand reader: %v\n", err)
-		os.Exit(1)
-	}
-	defer reader1.Close()
-
-	reader2, err := wiegand.New(ctx, wiegand.Config{
-		D0Pin:    "GPIO18",
-		D1Pin:    "GPIO27",
-		Callback: callback,
-		Timeout:  100 * time.Millisecond,
-		MaxBits:  26,
-	})
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize Wiegand reader: %v\n", err)
-		os.Exit(1)
-	}
-	defer reader2.Close()
-
-	reader3, err := wiegand.New(ctx, wiegand.Config{
-		D0Pin:    "GPIO22",
-		D1Pin:    "GPIO23",
-		Callback: callback,
-		Timeout:  100 * time.Millisecond,
-		MaxBits:  26,
+	// Cancel the context on SIGINT/SIGTERM for graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Log read errors, such as parity failures, to stderr
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	manager, err := wiegand.NewManager(ctx, wiegand.ManagerConfig{
+		Readers: []wiegand.ReaderDef{
+			{Name: "reader1", D0Pin: "GPIO4", D1Pin: "GPIO17"}, // Wiegand D0 (e.g., green wire), D1 (e.g., white wire)
+			{Name: "reader2", D0Pin: "GPIO18", D1Pin: "GPIO27"},
+			{Name: "reader3", D0Pin: "GPIO22", D1Pin: "GPIO23"},
+			{Name: "reader4", D0Pin: "GPIO24", D1Pin: "GPIO25"},
+		},
+		Reader: wiegand.Config{
+			Timeout: 100 * time.Millisecond,
+			Logger:  logger,
+		},
 	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize Wiegand reader: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Failed to initialize Wiegand readers: %v\n", err)
 		os.Exit(1)
 	}
-	defer reader3.Close()
+	defer manager.Close()
 
-	reader4, err := wiegand.New(ctx, wiegand.Config{
-		D0Pin:    "GPIO24",
-		D1Pin:    "GPIO25",
-		Callback: callback,
-		Timeout:  100 * time.Millisecond,
-		MaxBits:  26,
-	})
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize Wiegand reader: %v\n", err)
-		os.Exit(1)
+	// Process Wiegand data until the context is cancelled
+	for ev := range manager.Read() {
+		if c := ev.Credential; c != nil {
+			fmt.Printf("Received Wiegand data on %s: site: %d, tag: %d\n", c.Reader, c.Site, c.Tag)
+		}
 	}
-	defer reader4.Close()
-
-	// Handle SIGINT/SIGTERM for graceful shutdown
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-sigCh
-		cancel()
-	}()
-
-	// Keep program running to process Wiegand data
-	<-ctx.Done()
-	fmt.Println("Shutting down Wiegand reader")
+	fmt.Println("Shutting down Wiegand readers")
 }
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+// config is the JSON configuration file of wiegandd.
+type config struct {
+	Backend      backendConfig `json:"backend"`
+	Logging      loggingConfig `json:"logging"`
+	Timeout      string        `json:"timeout"`       // Frame timeout shared by all readers
+	RestartDelay string        `json:"restart_delay"` // Delay before restarting a failed reader
+	// DuplicateWindow and Duplicates ("drop" or "flag") suppress repeated
+	// reads of a card held against a reader.
+	DuplicateWindow string           `json:"duplicate_window"`
+	Duplicates      string           `json:"duplicates"`
+	Formats         []formatConfig   `json:"formats"` // Formats shared by all readers
+	Readers         []readerConfig   `json:"readers"`
+	Passback        []passbackConfig `json:"passback"` // Anti-passback areas
+	Outputs         []outputConfig   `json:"outputs"`
+}
+
+type backendConfig struct {
+	Type string `json:"type"` // "periph" (default) or "cdev"
+	Chip string `json:"chip"` // GPIO chip for "cdev"
+}
+
+type loggingConfig struct {
+	Level       string `json:"level"`       // "debug", "info" (default), "warn" or "error"
+	Format      string `json:"format"`      // "text" (default) or "json"
+	Credentials bool   `json:"credentials"` // Log card numbers instead of redacting them
+}
+
+type fieldConfig struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+type parityConfig struct {
+	Start  int  `json:"start"`
+	Length int  `json:"length"`
+	Bit    int  `json:"bit"`
+	Even   bool `json:"even"`
+}
+
+type formatConfig struct {
+	Name   string         `json:"name"`
+	Bits   int            `json:"bits"`
+	Site   fieldConfig    `json:"site"`
+	Tag    fieldConfig    `json:"tag"`
+	Parity []parityConfig `json:"parity"`
+}
+
+type readerConfig struct {
+	Name    string         `json:"name"`
+	D0      string         `json:"d0"`
+	D1      string         `json:"d1"`
+	Timeout string         `json:"timeout"`
+	Formats []formatConfig `json:"formats"`
+}
+
+type passbackConfig struct {
+	Name string   `json:"name"`
+	In   []string `json:"in"`  // Entry readers
+	Out  []string `json:"out"` // Exit readers
+}
+
+type outputConfig struct {
+	Type   string `json:"type"`   // "stdout", "http", "mqtt" or "webhook"
+	Listen string `json:"listen"` // Address the "http" output listens on
+
+	// Settings of the "mqtt" output; see package mqtt.
+	Broker            string `json:"broker"`
+	ClientID          string `json:"client_id"`
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	Topic             string `json:"topic"`
+	StatusTopic       string `json:"status_topic"`
+	ReaderStatusTopic string `json:"reader_status_topic"`
+	QoS               byte   `json:"qos"`
+
+	// Settings of the "webhook" output; see package webhook.
+	URL      string `json:"url"`
+	Secret   string `json:"secret"`
+	QueueDir string `json:"queue_dir"`
+}
+
+// settings is a validated configuration, ready to run.
+type settings struct {
+	manager        wiegand.ManagerConfig
+	logLevel       slog.Level
+	logJSON        bool
+	logCredentials bool
+	outputs        []outputConfig
+}
+
+// configError is a problem with the value at path in a configuration file.
+type configError struct {
+	file string
+	line int // Zero if path is not present in the file
+	path string
+	msg  string
+}
+
+func (e *configError) Error() string {
+	if e.line == 0 {
+		return fmt.Sprintf("%s: %s: %s", e.file, e.path, e.msg)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", e.file, e.line, e.path, e.msg)
+}
+
+// loadConfig reads and validates the configuration file at path.
+func loadConfig(path string) (*settings, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(path, data)
+}
+
+// parseConfig validates a configuration, reporting every problem found
+// rather than only the first.
+func parseConfig(file string, data []byte) (*settings, error) {
+	v := &validator{file: file, data: data, lines: make(map[string]int)}
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil {
+		var (
+			se *json.SyntaxError
+			te *json.UnmarshalTypeError
+		)
+		switch {
+		case errors.As(err, &se):
+			return nil, &configError{file: file, line: v.lineAt(se.Offset), path: "syntax", msg: se.Error()}
+		case errors.As(err, &te):
+			return nil, &configError{file: file, line: v.lineAt(te.Offset), path: te.Field, msg: fmt.Sprintf("cannot use %s as %s", te.Value, te.Type)}
+		}
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	v.locate()
+	s := v.validate(&c)
+	if len(v.errs) > 0 {
+		return nil, errors.Join(v.errs...)
+	}
+	return s, nil
+}
+
+// validator collects the problems with one configuration file.
+type validator struct {
+	file  string
+	data  []byte
+	lines map[string]int // Line of each value, by path such as "readers[1].d0"
+	errs  []error
+}
+
+func (v *validator) errorf(path, format string, args ...any) {
+	v.errs = append(v.errs, &configError{file: v.file, line: v.lines[path], path: path, msg: fmt.Sprintf(format, args...)})
+}
+
+// lineAt returns the line number of a byte offset in the file.
+func (v *validator) lineAt(offset int64) int {
+	return bytes.Count(v.data[:min(int(offset), len(v.data))], []byte("\n")) + 1
+}
+
+// locate records the line of every value in the file, and reports keys
+// which do not match a field of the configuration.
+func (v *validator) locate() {
+	dec := json.NewDecoder(bytes.NewReader(v.data))
+	v.walk(dec, reflect.TypeOf(config{}), "")
+}
+
+// walk consumes one value from dec, recording its line under path. t is
+// the Go type the value decodes into, or nil if unknown.
+func (v *validator) walk(dec *json.Decoder, t reflect.Type, path string) {
+	tok, err := dec.Token()
+	if err != nil {
+		return
+	}
+	if path != "" {
+		v.lines[path] = v.lineAt(dec.InputOffset())
+	}
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return
+			}
+			name := key.(string)
+			child := name
+			if path != "" {
+				child = path + "." + name
+			}
+			var ft reflect.Type
+			if t != nil && t.Kind() == reflect.Struct {
+				if f, ok := jsonField(t, name); ok {
+					ft = f.Type
+				} else {
+					v.lines[child] = v.lineAt(dec.InputOffset())
+					v.errorf(child, "unknown setting")
+				}
+			}
+			v.walk(dec, ft, child)
+		}
+		dec.Token()
+	case json.Delim('['):
+		var et reflect.Type
+		if t != nil && t.Kind() == reflect.Slice {
+			et = t.Elem()
+		}
+		for i := 0; dec.More(); i++ {
+			v.walk(dec, et, fmt.Sprintf("%s[%d]", path, i))
+		}
+		dec.Token()
+	}
+}
+
+// jsonField returns the field of struct type t decoded from the JSON key
+// name, matching case-insensitively as encoding/json does.
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if strings.EqualFold(tag, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// duration parses an optional duration setting, which must be positive.
+func (v *validator) duration(path, s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		v.errorf(path, "invalid duration %q", s)
+		return 0
+	}
+	return d
+}
+
+// formats converts and validates a list of formats.
+func (v *validator) formats(path string, fcs []formatConfig) []wiegand.Format {
+	var formats []wiegand.Format
+	for i, fc := range fcs {
+		f := wiegand.Format{
+			Name: fc.Name,
+			Bits: fc.Bits,
+			Site: wiegand.Field{Start: fc.Site.Start, Length: fc.Site.Length},
+			Tag:  wiegand.Field{Start: fc.Tag.Start, Length: fc.Tag.Length},
+		}
+		for _, p := range fc.Parity {
+			f.Parity = append(f.Parity, wiegand.ParityCheck{Field: wiegand.Field{Start: p.Start, Length: p.Length}, Bit: p.Bit, Even: p.Even})
+		}
+		fp := fmt.Sprintf("%s[%d]", path, i)
+		if f.Name == "" {
+			v.errorf(fp, "format name is required")
+		}
+		if err := f.Validate(); err != nil {
+			v.errorf(fp, "%v", err)
+			continue
+		}
+		formats = append(formats, f)
+	}
+	return formats
+}
+
+// validate checks c and converts it to settings.
+func (v *validator) validate(c *config) *settings {
+	s := &settings{logCredentials: c.Logging.Credentials}
+
+	switch c.Backend.Type {
+	case "", "periph":
+		if c.Backend.Chip != "" {
+			v.errorf("backend.chip", "only used by the cdev backend")
+		}
+		s.manager.Reader.Backend = wiegand.PeriphBackend{}
+	case "cdev":
+		s.manager.Reader.Backend = wiegand.CdevBackend{Chip: c.Backend.Chip, Consumer: "wiegandd"}
+	default:
+		v.errorf("backend.type", "unknown backend %q, want periph or cdev", c.Backend.Type)
+	}
+
+	switch strings.ToLower(c.Logging.Level) {
+	case "", "info":
+		s.logLevel = slog.LevelInfo
+	case "debug":
+		s.logLevel = slog.LevelDebug
+	case "warn":
+		s.logLevel = slog.LevelWarn
+	case "error":
+		s.logLevel = slog.LevelError
+	default:
+		v.errorf("logging.level", "unknown level %q", c.Logging.Level)
+	}
+	switch c.Logging.Format {
+	case "", "text":
+	case "json":
+		s.logJSON = true
+	default:
+		v.errorf("logging.format", "unknown format %q, want text or json", c.Logging.Format)
+	}
+
+	s.manager.Reader.Timeout = v.duration("timeout", c.Timeout)
+	s.manager.RestartDelay = v.duration("restart_delay", c.RestartDelay)
+	s.manager.Reader.Formats = v.formats("formats", c.Formats)
+	s.manager.Reader.DuplicateWindow = v.duration("duplicate_window", c.DuplicateWindow)
+	switch c.Duplicates {
+	case "", "drop":
+	case "flag":
+		s.manager.Reader.Duplicates = wiegand.DuplicateFlag
+	default:
+		v.errorf("duplicates", "unknown duplicate policy %q, want drop or flag", c.Duplicates)
+	}
+
+	if len(c.Readers) == 0 {
+		v.errorf("readers", "at least one reader is required")
+	}
+	names := make(map[string]string) // Path of the reader with each name
+	pins := make(map[string]string)  // Path of the setting using each pin
+	for i, rc := range c.Readers {
+		path := fmt.Sprintf("readers[%d]", i)
+		switch prev, dup := names[rc.Name]; {
+		case rc.Name == "":
+			v.errorf(path, "name is required")
+		case dup:
+			v.errorf(path+".name", "duplicate reader name %q, also used by %s", rc.Name, prev)
+		default:
+			names[rc.Name] = path
+		}
+		for _, pin := range []struct{ key, name string }{{"d0", rc.D0}, {"d1", rc.D1}} {
+			pp := path + "." + pin.key
+			if pin.name == "" {
+				v.errorf(path, "%s pin is required", pin.key)
+				continue
+			}
+			if prev, dup := pins[pin.name]; dup {
+				v.errorf(pp, "pin %s is already used by %s", pin.name, prev)
+				continue
+			}
+			pins[pin.name] = pp
+		}
+		s.manager.Readers = append(s.manager.Readers, wiegand.ReaderDef{
+			Name:    rc.Name,
+			D0Pin:   rc.D0,
+			D1Pin:   rc.D1,
+			Timeout: v.duration(path+".timeout", rc.Timeout),
+			Formats: v.formats(path+".formats", rc.Formats),
+		})
+	}
+
+	for i, pc := range c.Passback {
+		path := fmt.Sprintf("passback[%d]", i)
+		if pc.Name == "" {
+			v.errorf(path, "name is required")
+		}
+		for _, dir := range []struct {
+			key   string
+			names []string
+		}{{"in", pc.In}, {"out", pc.Out}} {
+			if len(dir.names) == 0 {
+				v.errorf(path, "%s readers are required", dir.key)
+			}
+			for j, name := range dir.names {
+				if _, ok := names[name]; !ok {
+					v.errorf(fmt.Sprintf("%s.%s[%d]", path, dir.key, j), "unknown reader %q", name)
+				}
+			}
+		}
+		for j, name := range pc.Out {
+			if slices.Contains(pc.In, name) {
+				v.errorf(fmt.Sprintf("%s.out[%d]", path, j), "reader %q both enters and leaves", name)
+			}
+		}
+		s.manager.Passback = append(s.manager.Passback, wiegand.PassbackArea{Name: pc.Name, In: pc.In, Out: pc.Out})
+	}
+	if len(c.Passback) > 0 && s.manager.Reader.DuplicateWindow <= 0 {
+		v.errorf("passback", "duplicate_window is required, so that the repeated frames of a held card are not denied entry")
+	}
+
+	for i, oc := range c.Outputs {
+		path := fmt.Sprintf("outputs[%d]", i)
+		if _, ok := outputTypes[oc.Type]; !ok {
+			v.errorf(path+".type", "unknown output %q", oc.Type)
+		}
+		switch oc.Type {
+		case "http":
+			if oc.Listen == "" {
+				v.errorf(path, "listen address is required")
+			}
+		case "mqtt":
+			if oc.Broker == "" {
+				v.errorf(path, "broker address is required")
+			}
+			if oc.QoS > 1 {
+				v.errorf(path+".qos", "QoS must be 0 or 1")
+			}
+		case "webhook":
+			if u, err := url.Parse(oc.URL); oc.URL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.errorf(path+".url", "an http or https URL is required")
+			}
+		}
+	}
+	s.outputs = c.Outputs
+	return s
+}
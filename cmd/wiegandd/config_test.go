@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExampleConfig(t *testing.T) {
+	s, err := loadConfig("wiegandd.example.json")
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if len(s.manager.Readers) != 2 || s.manager.Readers[1].Timeout != 150*time.Millisecond {
+		t.Errorf("readers = %+v, want front-door and back-door", s.manager.Readers)
+	}
+	if s.manager.Reader.DuplicateWindow != time.Second || len(s.manager.Passback) != 1 || s.manager.Passback[0].In[0] != "front-door" {
+		t.Errorf("duplicate window %v and passback %+v, want 1s and the building area", s.manager.Reader.DuplicateWindow, s.manager.Passback)
+	}
+	if len(s.manager.Reader.Formats) != 1 || s.manager.Reader.Formats[0].Bits != 35 {
+		t.Errorf("formats = %+v, want the 35-bit format", s.manager.Reader.Formats)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	const data = `{
+  "backend": {"type": "spi"},
+  "timeout": "soon",
+  "readers": [
+    {"name": "a", "d0": "GPIO4", "d1": "GPIO17"},
+    {"name": "a", "d0": "GPIO4"},
+    {"name": "b", "d0": "GPIO5", "d1": "GPIO6", "colour": "red",
+     "formats": [{"name": "bad", "bits": 10, "site": {"start": 0, "length": 20}}]}
+  ],
+  "outputs": [{"type": "carrier-pigeon"}, {"type": "webhook", "url": "ftp://example.com"}],
+  "passback": [{"name": "lobby", "in": ["a"], "out": ["c"]}, {"name": "hall", "in": ["a", "b"], "out": ["b"]}]
+}`
+	_, err := parseConfig("test.json", []byte(data))
+	if err == nil {
+		t.Fatal("parseConfig() succeeded, want errors")
+	}
+	want := []string{
+		`test.json:2: backend.type: unknown backend "spi"`,
+		`test.json:3: timeout: invalid duration "soon"`,
+		`test.json:6: readers[1].name: duplicate reader name "a", also used by readers[0]`,
+		`test.json:6: readers[1].d0: pin GPIO4 is already used by readers[0].d0`,
+		`test.json:6: readers[1]: d1 pin is required`,
+		`test.json:7: readers[2].colour: unknown setting`,
+		`test.json:8: readers[2].formats[0]: format "bad": site field`,
+		`test.json:10: outputs[0].type: unknown output "carrier-pigeon"`,
+		`test.json:10: outputs[1].url: an http or https URL is required`,
+		`test.json:11: passback[0].out[0]: unknown reader "c"`,
+		`test.json:11: passback[1].out[0]: reader "b" both enters and leaves`,
+		`test.json:11: passback: duplicate_window is required`,
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != len(want) {
+		t.Errorf("got %d errors, want %d:\n%v", len(lines), len(want), err)
+	}
+	for _, w := range want {
+		found := false
+		for _, l := range lines {
+			found = found || strings.HasPrefix(l, w)
+		}
+		if !found {
+			t.Errorf("errors do not include %q:\n%v", w, err)
+		}
+	}
+}
+
+func TestConfigSyntaxError(t *testing.T) {
+	_, err := parseConfig("test.json", []byte("{\n  \"readers\": [\n    {\"name\": 5}\n  ]\n}"))
+	var ce *configError
+	if !errors.As(err, &ce) || ce.line != 3 {
+		t.Errorf("parseConfig() error = %v, want type error on line 3", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Command wiegandd runs the Wiegand readers described by a JSON
+// configuration file and publishes their events to the configured outputs.
+// It runs until SIGINT or SIGTERM, and reloads the configuration on SIGHUP.
+//
+// Usage:
+//
+//	wiegandd [-config /etc/wiegandd.json] [-check]
+//
+// With -check the configuration is validated, reporting every problem with
+// its line number, and wiegandd exits without opening any GPIO pins.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+func main() {
+	configPath := flag.String("config", "/etc/wiegandd.json", "path of the configuration file")
+	check := flag.Bool("check", false, "validate the configuration and exit without opening GPIO pins")
+	flag.Parse()
+
+	s, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *check {
+		fmt.Printf("%s: OK\n", *configPath)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	d, err := start(ctx, s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			if err := d.stop(); err != nil {
+				d.logger.Error("shutdown", "error", err)
+			}
+			return
+		case <-hup:
+			nd, err := reload(ctx, d, *configPath)
+			if err != nil {
+				d.logger.Error("reload: previous configuration failed too", "error", err)
+				stop()
+				os.Exit(1)
+			}
+			d = nd
+		}
+	}
+}
+
+// daemon is a running configuration.
+type daemon struct {
+	settings *settings
+	logger   *slog.Logger
+	manager  *wiegand.Manager
+	outputs  []output
+	done     chan struct{} // Closed when all events have been published
+}
+
+// start opens the readers and outputs of s and starts publishing events.
+func start(ctx context.Context, s *settings) (*daemon, error) {
+	opts := &slog.HandlerOptions{Level: s.logLevel}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if s.logJSON {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	d := &daemon{settings: s, logger: slog.New(handler), done: make(chan struct{})}
+
+	mc := s.manager
+	mc.Reader.Logger = d.logger
+	mc.Reader.LogCredentials = s.logCredentials
+	m, err := wiegand.NewManager(ctx, mc)
+	if err != nil {
+		return nil, err
+	}
+	d.manager = m
+
+	// Events wait in the Manager until the outputs are ready.
+	ocs := s.outputs
+	if len(ocs) == 0 {
+		ocs = []outputConfig{{Type: "stdout"}}
+	}
+	for _, oc := range ocs {
+		o, err := outputTypes[oc.Type](oc, d)
+		if err != nil {
+			m.Close()
+			d.closeOutputs()
+			return nil, fmt.Errorf("output %s: %w", oc.Type, err)
+		}
+		d.outputs = append(d.outputs, o)
+	}
+	go d.publish()
+	d.logger.Info("started", "readers", len(mc.Readers), "outputs", len(d.outputs))
+	return d, nil
+}
+
+// publish sends every event to every output.
+func (d *daemon) publish() {
+	defer close(d.done)
+	for ev := range d.manager.Read() {
+		for _, o := range d.outputs {
+			o.Publish(ev)
+		}
+	}
+}
+
+// stop closes the readers, waits for their last events to be published,
+// then closes the outputs.
+func (d *daemon) stop() error {
+	err := d.manager.Close()
+	<-d.done
+	return errors.Join(err, d.closeOutputs())
+}
+
+func (d *daemon) closeOutputs() error {
+	var errs []error
+	for _, o := range d.outputs {
+		errs = append(errs, o.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// reload replaces d with a daemon running the configuration at path. If the
+// configuration is invalid d keeps running; if it cannot be started, d's
+// configuration is started again. An error means that failed too, leaving
+// nothing running.
+func reload(ctx context.Context, d *daemon, path string) (*daemon, error) {
+	s, err := loadConfig(path)
+	if err != nil {
+		d.logger.Error("reload: keeping the current configuration", "error", err)
+		return d, nil
+	}
+	if err := d.stop(); err != nil {
+		d.logger.Warn("reload: stopping", "error", err)
+	}
+	nd, err := start(ctx, s)
+	if err == nil {
+		nd.logger.Info("reloaded", "config", path)
+		return nd, nil
+	}
+	d.logger.Error("reload: restoring the previous configuration", "error", err)
+	return start(ctx, d.settings)
+}
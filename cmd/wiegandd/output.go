@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+	"github.com/asjoyner/wiegand-go/httpapi"
+	"github.com/asjoyner/wiegand-go/mqtt"
+	"github.com/asjoyner/wiegand-go/webhook"
+)
+
+// output publishes reader events to a consumer.
+type output interface {
+	Publish(ev wiegand.Event)
+	Close() error
+}
+
+// outputTypes constructs each type of output named in the configuration.
+var outputTypes = map[string]func(oc outputConfig, d *daemon) (output, error){
+	"stdout":  func(outputConfig, *daemon) (output, error) { return newJSONLines(os.Stdout), nil },
+	"http":    newHTTPOutput,
+	"mqtt":    newMQTTOutput,
+	"webhook": newWebhookOutput,
+}
+
+// jsonLines writes each event as a line of JSON.
+type jsonLines struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newJSONLines(w io.Writer) *jsonLines {
+	return &jsonLines{enc: json.NewEncoder(w)}
+}
+
+func (o *jsonLines) Publish(ev wiegand.Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.enc.Encode(ev)
+}
+
+func (o *jsonLines) Close() error { return nil }
+
+// httpOutput serves events with package httpapi.
+type httpOutput struct {
+	*httpapi.Server
+	srv *http.Server
+}
+
+func newHTTPOutput(oc outputConfig, d *daemon) (output, error) {
+	api := httpapi.New(httpapi.Config{Status: d.manager.Health, Formats: d.manager.Formats()})
+	ln, err := net.Listen("tcp", oc.Listen)
+	if err != nil {
+		return nil, err
+	}
+	o := &httpOutput{Server: api, srv: &http.Server{Handler: api}}
+	go func() {
+		if err := o.srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			d.logger.Error("http output", "error", err)
+		}
+	}()
+	return o, nil
+}
+
+// Close ends the event streams, then shuts the server down.
+func (o *httpOutput) Close() error {
+	o.Server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return o.srv.Shutdown(ctx)
+}
+
+func newMQTTOutput(oc outputConfig, d *daemon) (output, error) {
+	var readers []string
+	for _, def := range d.settings.manager.Readers {
+		readers = append(readers, def.Name)
+	}
+	return mqtt.New(mqtt.Config{
+		Broker:            oc.Broker,
+		ClientID:          oc.ClientID,
+		Username:          oc.Username,
+		Password:          oc.Password,
+		Topic:             oc.Topic,
+		StatusTopic:       oc.StatusTopic,
+		Readers:           readers,
+		ReaderStatusTopic: oc.ReaderStatusTopic,
+		QoS:               oc.QoS,
+		ErrorHandler:      func(err error) { d.logger.Warn("mqtt output", "error", err) },
+	})
+}
+
+func newWebhookOutput(oc outputConfig, d *daemon) (output, error) {
+	return webhook.New(webhook.Config{
+		URL:          oc.URL,
+		Secret:       []byte(oc.Secret),
+		QueueDir:     oc.QueueDir,
+		ErrorHandler: func(err error) { d.logger.Warn("webhook output", "error", err) },
+	})
+}
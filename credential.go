@@ -0,0 +1,38 @@
+package wiegand
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Credential is a successfully decoded Wiegand frame.
+type Credential struct {
+	Reader string    // Name of the Reader that received the frame
+	Format string    // Name of the Format used to decode the frame
+	Bits   []byte    // Raw frame bits, each 0 or 1, in the order received
+	Site   uint64    // Site (facility) code
+	Tag    uint64    // Tag (card number)
+	Time   time.Time // Time the last bit of the frame was received
+	// Duplicate is set on a credential read again within the Reader's
+	// Config.DuplicateWindow, when its Config.Duplicates is DuplicateFlag.
+	Duplicate bool
+}
+
+// BitCount returns the length of the frame in bits.
+func (c Credential) BitCount() int {
+	return len(c.Bits)
+}
+
+// String returns a short description of the credential, e.g. "26-bit 15:54321".
+func (c Credential) String() string {
+	return fmt.Sprintf("%s %d:%d", c.Format, c.Site, c.Tag)
+}
+
+// stringCallback adapts a callback taking decimal site and tag strings to one
+// taking a Credential.
+func stringCallback(cb func(string, string)) func(Credential) {
+	return func(c Credential) {
+		cb(strconv.FormatUint(c.Site, 10), strconv.FormatUint(c.Tag, 10))
+	}
+}
@@ -0,0 +1,471 @@
+// Package door controls a door: it energizes the strike relay to unlock it,
+// honors a request-to-exit (REX) button, watches a door-position contact,
+// and raises door-held-open and door-forced alarms.
+//
+// The strike is a wiegand.OutputPin and the inputs are opened through a
+// wiegand.Backend, so a Door runs on the same GPIO backends as a Reader and
+// can be tested with package wiegandtest. After an access decision:
+//
+//	d, err := door.New(door.Config{
+//		Name: "front-door", StrikePin: "GPIO23", REXPin: "GPIO24", ContactPin: "GPIO25",
+//		EventHandler: func(e door.Event) { log.Println(e) },
+//	})
+//	...
+//	if decision.Granted {
+//		d.Unlock()
+//	}
+package door
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+// Defaults for Config.
+const (
+	DefaultUnlockTime   = 5 * time.Second
+	DefaultHeldOpenTime = 30 * time.Second
+	DefaultDebounce     = 20 * time.Millisecond
+)
+
+// Clock provides the time and timers for a Door, so that tests can control
+// them.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine after d has elapsed, unless the
+	// returned Timer is stopped first.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending call scheduled by Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the call, reporting whether it was still pending.
+	Stop() bool
+}
+
+// realClock is the Clock used when Config.Clock is nil.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// EventType identifies what happened at a door.
+type EventType int
+
+const (
+	// Unlocked means the strike was energized.
+	Unlocked EventType = iota
+	// Locked means the strike was released after the unlock time or by
+	// Lock.
+	Locked
+	// Opened means the door-position contact reported the door open.
+	Opened
+	// Closed means the door-position contact reported the door closed.
+	Closed
+	// RequestToExit means the REX button was pressed. The door is unlocked.
+	RequestToExit
+	// HeldOpen is an alarm: the door has been open for longer than the
+	// held-open time.
+	HeldOpen
+	// Forced is an alarm: the door was opened while locked.
+	Forced
+)
+
+var eventNames = [...]string{
+	Unlocked:      "unlocked",
+	Locked:        "locked",
+	Opened:        "opened",
+	Closed:        "closed",
+	RequestToExit: "request_to_exit",
+	HeldOpen:      "held_open",
+	Forced:        "forced",
+}
+
+func (t EventType) String() string {
+	if t < 0 || int(t) >= len(eventNames) {
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+	return eventNames[t]
+}
+
+// MarshalText encodes the EventType as its String, e.g. "held_open".
+func (t EventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Event reports a change at a door.
+type Event struct {
+	Door string    `json:"door"` // Config.Name of the Door
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+}
+
+// Alarm reports whether the event is an alarm.
+func (e Event) Alarm() bool {
+	return e.Type == HeldOpen || e.Type == Forced
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s: %s", e.Door, e.Type)
+}
+
+// Config holds configuration for creating a Door.
+type Config struct {
+	Name string // Name reported in Events
+
+	// StrikePin names the GPIO driving the strike relay, opened with
+	// wiegand.PeriphBackend if Strike is nil.
+	StrikePin string
+	Strike    wiegand.OutputPin // Already opened strike output (optional)
+	// StrikeActiveLow drives the strike output low to unlock. By default
+	// it is driven high to unlock and low to lock.
+	StrikeActiveLow bool
+	UnlockTime      time.Duration // How long Unlock releases the door (default DefaultUnlockTime)
+
+	// REXPin and ContactPin name the request-to-exit and door-position
+	// inputs, opened with Backend. Both are optional.
+	REXPin     string
+	ContactPin string
+	Backend    wiegand.Backend // Opens the inputs (default wiegand.PeriphBackend)
+	// REXActiveLow means the REX input reads low while the button is
+	// pressed. By default it reads high.
+	REXActiveLow bool
+	// ContactOpenHigh means the contact input reads high while the door is
+	// open. By default it reads low, as with a contact which closes a
+	// circuit to 3.3V while the door is shut. The door is assumed closed
+	// when the Door is created.
+	ContactOpenHigh bool
+	// Debounce is how long an input must be stable before a change is
+	// accepted (default DefaultDebounce).
+	Debounce     time.Duration
+	HeldOpenTime time.Duration // Open time before a HeldOpen alarm (default DefaultHeldOpenTime)
+
+	Clock        Clock       // Time source for the unlock and held-open timers (default: the system clock)
+	EventHandler func(Event) // Called with each Event (optional)
+	// ErrorHandler is called if an input fails. The door keeps working
+	// without it. Optional.
+	ErrorHandler func(error)
+}
+
+// State is a snapshot of a Door.
+type State struct {
+	Unlocked bool // The strike is energized
+	Open     bool // The contact reports the door open
+	HeldOpen bool // A HeldOpen alarm is active
+	Forced   bool // The door was forced and has not closed since
+}
+
+// Door controls one door. It is safe for concurrent use.
+type Door struct {
+	cfg    Config
+	strike wiegand.OutputPin
+	opened bool       // Whether New opened the strike, to be released by Close
+	locked gpio.Level // Strike level when locked
+	inputs []wiegand.EdgeSource
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	state    State
+	relock   Timer  // Pending relock, while unlocked
+	held     Timer  // Pending HeldOpen alarm, while open
+	unlockID uint64 // Incremented by each Unlock and Lock, to ignore stale relocks
+	openID   uint64 // Incremented by each open and close, to ignore stale alarms
+	closed   bool
+}
+
+// New creates a Door, locks it, and starts watching its inputs.
+func New(cfg Config) (*Door, error) {
+	if cfg.UnlockTime <= 0 {
+		cfg.UnlockTime = DefaultUnlockTime
+	}
+	if cfg.HeldOpenTime <= 0 {
+		cfg.HeldOpenTime = DefaultHeldOpenTime
+	}
+	if cfg.Debounce <= 0 {
+		cfg.Debounce = DefaultDebounce
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = realClock{}
+	}
+	if cfg.Backend == nil {
+		cfg.Backend = wiegand.PeriphBackend{}
+	}
+	d := &Door{cfg: cfg, strike: cfg.Strike, locked: gpio.Low}
+	if cfg.StrikeActiveLow {
+		d.locked = gpio.High
+	}
+	if d.strike == nil {
+		if cfg.StrikePin == "" {
+			return nil, errors.New("strike pin must be specified")
+		}
+		var err error
+		if d.strike, err = (wiegand.PeriphBackend{}).OpenOutput(cfg.StrikePin, d.locked); err != nil {
+			return nil, fmt.Errorf("failed to configure strike pin %s: %w", cfg.StrikePin, err)
+		}
+		d.opened = true
+	}
+	if err := d.strike.Out(d.locked); err != nil {
+		d.releaseStrike()
+		return nil, fmt.Errorf("failed to lock door: %w", err)
+	}
+
+	inputs := []struct {
+		name   string
+		active gpio.Level
+		apply  func(active bool) ([]Event, error)
+	}{
+		{cfg.REXPin, gpio.Level(!cfg.REXActiveLow), d.rex},
+		{cfg.ContactPin, gpio.Level(cfg.ContactOpenHigh), d.contact},
+	}
+	for _, in := range inputs {
+		if in.name == "" {
+			continue
+		}
+		src, err := cfg.Backend.Open(in.name, gpio.BothEdges)
+		if err != nil {
+			d.closeInputs()
+			d.releaseStrike()
+			return nil, fmt.Errorf("failed to configure input pin %s: %w", in.name, err)
+		}
+		d.inputs = append(d.inputs, src)
+		d.wg.Add(1)
+		go d.watch(src, in.active, in.apply)
+	}
+	return d, nil
+}
+
+// Unlock energizes the strike for Config.UnlockTime. Unlocking an unlocked
+// door restarts the unlock time.
+func (d *Door) Unlock() error {
+	d.mu.Lock()
+	events, err := d.unlock()
+	d.mu.Unlock()
+	d.emit(events)
+	return err
+}
+
+// Lock releases the strike immediately.
+func (d *Door) Lock() error {
+	d.mu.Lock()
+	d.unlockID++
+	events, err := d.lock()
+	d.mu.Unlock()
+	d.emit(events)
+	return err
+}
+
+// State returns the current state of the door.
+func (d *Door) State() State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state
+}
+
+// Close stops watching the inputs, cancels the timers and locks the door. A
+// strike opened from StrikePin is then released.
+func (d *Door) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mu.Unlock()
+	errs := []error{d.closeInputs()}
+	d.wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.unlockID++
+	d.openID++
+	if d.relock != nil {
+		d.relock.Stop()
+	}
+	if d.held != nil {
+		d.held.Stop()
+	}
+	d.state.Unlocked = false
+	errs = append(errs, d.strike.Out(d.locked))
+	return errors.Join(append(errs, d.releaseStrike())...)
+}
+
+// releaseStrike releases the strike output if New opened it: periph pins
+// are halted, and outputs implementing io.Closer are closed.
+func (d *Door) releaseStrike() error {
+	if !d.opened {
+		return nil
+	}
+	d.opened = false
+	switch p := d.strike.(type) {
+	case io.Closer:
+		return p.Close()
+	case interface{ Halt() error }:
+		return p.Halt()
+	}
+	return nil
+}
+
+func (d *Door) closeInputs() error {
+	var errs []error
+	for _, src := range d.inputs {
+		errs = append(errs, src.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// event returns an Event of type t happening now.
+func (d *Door) event(t EventType) Event {
+	return Event{Door: d.cfg.Name, Type: t, Time: d.cfg.Clock.Now()}
+}
+
+// emit passes events to the EventHandler. d.mu must not be held, so that
+// the handler may call back into the Door.
+func (d *Door) emit(events []Event) {
+	if d.cfg.EventHandler == nil {
+		return
+	}
+	for _, e := range events {
+		d.cfg.EventHandler(e)
+	}
+}
+
+// unlock energizes the strike and schedules the relock. d.mu must be held.
+func (d *Door) unlock() ([]Event, error) {
+	if d.closed {
+		return nil, errors.New("door closed")
+	}
+	if d.relock != nil {
+		d.relock.Stop()
+	}
+	d.unlockID++
+	id := d.unlockID
+	d.relock = d.cfg.Clock.AfterFunc(d.cfg.UnlockTime, func() {
+		d.mu.Lock()
+		var events []Event
+		if id == d.unlockID {
+			events, _ = d.lock()
+		}
+		d.mu.Unlock()
+		d.emit(events)
+	})
+	if d.state.Unlocked {
+		return nil, nil
+	}
+	if err := d.strike.Out(!d.locked); err != nil {
+		return nil, fmt.Errorf("failed to unlock door: %w", err)
+	}
+	d.state.Unlocked = true
+	return []Event{d.event(Unlocked)}, nil
+}
+
+// lock releases the strike. d.mu must be held.
+func (d *Door) lock() ([]Event, error) {
+	if d.relock != nil {
+		d.relock.Stop()
+		d.relock = nil
+	}
+	if !d.state.Unlocked {
+		return nil, nil
+	}
+	if err := d.strike.Out(d.locked); err != nil {
+		return nil, fmt.Errorf("failed to lock door: %w", err)
+	}
+	d.state.Unlocked = false
+	return []Event{d.event(Locked)}, nil
+}
+
+// rex handles a change of the REX input.
+func (d *Door) rex(pressed bool) ([]Event, error) {
+	if !pressed {
+		return nil, nil
+	}
+	events, err := d.unlock()
+	return append([]Event{d.event(RequestToExit)}, events...), err
+}
+
+// contact handles a change of the door-position input.
+func (d *Door) contact(open bool) ([]Event, error) {
+	if open == d.state.Open {
+		return nil, nil
+	}
+	d.state.Open = open
+	d.openID++
+	if !open {
+		if d.held != nil {
+			d.held.Stop()
+			d.held = nil
+		}
+		d.state.HeldOpen, d.state.Forced = false, false
+		return []Event{d.event(Closed)}, nil
+	}
+	events := []Event{d.event(Opened)}
+	if !d.state.Unlocked {
+		d.state.Forced = true
+		events = append(events, d.event(Forced))
+	}
+	id := d.openID
+	d.held = d.cfg.Clock.AfterFunc(d.cfg.HeldOpenTime, func() {
+		d.mu.Lock()
+		var events []Event
+		if id == d.openID && !d.state.HeldOpen {
+			d.state.HeldOpen = true
+			events = append(events, d.event(HeldOpen))
+		}
+		d.mu.Unlock()
+		d.emit(events)
+	})
+	return events, nil
+}
+
+// watch follows an input until it is closed, calling apply with d.mu held
+// whenever the input settles at a new level.
+func (d *Door) watch(src wiegand.EdgeSource, active gpio.Level, apply func(active bool) ([]Event, error)) {
+	defer d.wg.Done()
+	level := !active // Inputs are assumed inactive at start
+	settled := level
+	for {
+		timeout := time.Second
+		if level != settled {
+			timeout = d.cfg.Debounce
+		}
+		e, ok, err := src.WaitForEdge(timeout)
+		if err != nil {
+			if !errors.Is(err, wiegand.ErrClosed) {
+				d.report(err)
+			}
+			return
+		}
+		if ok {
+			level = gpio.Level(e.Rising)
+			continue
+		}
+		if level == settled {
+			continue
+		}
+		settled = level
+		d.mu.Lock()
+		var events []Event
+		if !d.closed {
+			events, err = apply(level == active)
+		}
+		d.mu.Unlock()
+		d.emit(events)
+		if err != nil {
+			d.report(err)
+		}
+	}
+}
+
+func (d *Door) report(err error) {
+	if d.cfg.ErrorHandler != nil {
+		d.cfg.ErrorHandler(err)
+	}
+}
@@ -0,0 +1,226 @@
+package door_test
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+
+	"github.com/asjoyner/wiegand-go"
+	"github.com/asjoyner/wiegand-go/door"
+	"github.com/asjoyner/wiegand-go/wiegandtest"
+)
+
+// fakeClock is a door.Clock whose time only moves on Advance.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	c       *fakeClock
+	at      time.Time
+	f       func()
+	pending bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) door.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c: c, at: c.now.Add(d), f: f, pending: true}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	was := t.pending
+	t.pending = false
+	return was
+}
+
+// Advance moves the clock forward, calling the timers which fall due in
+// order.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*fakeTimer
+	for _, t := range c.timers {
+		if t.pending && !t.at.After(c.now) {
+			t.pending = false
+			due = append(due, t)
+		}
+	}
+	c.timers = slices.DeleteFunc(c.timers, func(t *fakeTimer) bool { return !t.pending })
+	c.mu.Unlock()
+	slices.SortStableFunc(due, func(a, b *fakeTimer) int { return a.at.Compare(b.at) })
+	for _, t := range due {
+		t.f()
+	}
+}
+
+// strikePin records the level the strike is driven to.
+type strikePin struct {
+	mu    sync.Mutex
+	level gpio.Level
+}
+
+func (p *strikePin) Out(l gpio.Level) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.level = l
+	return nil
+}
+
+func (p *strikePin) Level() gpio.Level {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.level
+}
+
+// testDoor is a Door with its REX button on D0 and its contact on D1 of a
+// simulated line. Both idle high, so the button is active low and the
+// contact reads low while the door is open.
+type testDoor struct {
+	*door.Door
+	clock        *fakeClock
+	strike       *strikePin
+	rex, contact wiegand.OutputPin
+	events       chan door.Event
+}
+
+func newTestDoor(t *testing.T) *testDoor {
+	t.Helper()
+	line := wiegandtest.NewLine()
+	d := &testDoor{
+		clock:  &fakeClock{now: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)},
+		strike: &strikePin{level: gpio.High},
+		events: make(chan door.Event, 20),
+	}
+	d.rex, d.contact = line.Outputs()
+	var err error
+	d.Door, err = door.New(door.Config{
+		Name:         "front-door",
+		Strike:       d.strike,
+		REXPin:       "D0",
+		ContactPin:   "D1",
+		Backend:      line,
+		REXActiveLow: true,
+		Debounce:     50 * time.Millisecond,
+		UnlockTime:   5 * time.Second,
+		HeldOpenTime: 30 * time.Second,
+		Clock:        d.clock,
+		EventHandler: func(e door.Event) { d.events <- e },
+		ErrorHandler: func(err error) { t.Errorf("door error: %v", err) },
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	if d.strike.Level() != gpio.Low {
+		t.Fatal("New() did not lock the strike")
+	}
+	return d
+}
+
+// expect waits for events of the given types, in order.
+func (d *testDoor) expect(t *testing.T, types ...door.EventType) {
+	t.Helper()
+	for _, want := range types {
+		select {
+		case e := <-d.events:
+			if e.Type != want || e.Door != "front-door" {
+				t.Fatalf("event = %v, want %v", e, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %v", want)
+		}
+	}
+}
+
+// expectNone checks that no event is pending.
+func (d *testDoor) expectNone(t *testing.T) {
+	t.Helper()
+	select {
+	case e := <-d.events:
+		t.Fatalf("unexpected event %v", e)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	d := newTestDoor(t)
+	d.Unlock()
+	d.expect(t, door.Unlocked)
+	if d.strike.Level() != gpio.High || !d.State().Unlocked {
+		t.Fatal("Unlock() did not energize the strike")
+	}
+
+	// A second unlock restarts the unlock time.
+	d.clock.Advance(4 * time.Second)
+	d.Unlock()
+	d.clock.Advance(4 * time.Second)
+	d.expectNone(t)
+	d.clock.Advance(time.Second)
+	d.expect(t, door.Locked)
+	if d.strike.Level() != gpio.Low || d.State().Unlocked {
+		t.Error("strike still energized after the unlock time")
+	}
+
+	d.Unlock()
+	d.Lock()
+	d.expect(t, door.Unlocked, door.Locked)
+	d.clock.Advance(10 * time.Second)
+	d.expectNone(t)
+}
+
+func TestRequestToExit(t *testing.T) {
+	d := newTestDoor(t)
+	d.rex.Out(gpio.Low)
+	d.expect(t, door.RequestToExit, door.Unlocked)
+	d.rex.Out(gpio.High)
+
+	// The door opened during the unlock time is not forced.
+	d.contact.Out(gpio.Low)
+	d.expect(t, door.Opened)
+	d.contact.Out(gpio.High)
+	d.expect(t, door.Closed)
+	d.clock.Advance(5 * time.Second)
+	d.expect(t, door.Locked)
+}
+
+func TestForcedAndHeldOpen(t *testing.T) {
+	d := newTestDoor(t)
+	// A bouncing contact is reported once it settles.
+	d.contact.Out(gpio.Low)
+	d.contact.Out(gpio.High)
+	d.contact.Out(gpio.Low)
+	d.expect(t, door.Opened, door.Forced)
+	if s := d.State(); !s.Open || !s.Forced {
+		t.Errorf("State() = %+v, want open and forced", s)
+	}
+
+	d.clock.Advance(29 * time.Second)
+	d.expectNone(t)
+	d.clock.Advance(time.Second)
+	d.expect(t, door.HeldOpen)
+	if s := d.State(); !s.HeldOpen {
+		t.Errorf("State() = %+v, want held open", s)
+	}
+
+	d.contact.Out(gpio.High)
+	d.expect(t, door.Closed)
+	if s := d.State(); s != (door.State{}) {
+		t.Errorf("State() after closing = %+v, want all clear", s)
+	}
+}
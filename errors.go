@@ -0,0 +1,123 @@
+package wiegand
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParityError reports a frame of a known format which failed a parity check.
+type ParityError struct {
+	Reader string // Name of the Reader that received the frame
+	Format string // Name of the frame's Format
+	Bits   []byte // Raw frame bits
+	Site   uint64 // Site code as decoded despite the failure
+	Tag    uint64 // Tag as decoded despite the failure
+	// Failed holds the indexes into the Format's Parity checks which
+	// failed. For the built-in formats 0 is the leading (even) half of
+	// the frame and 1 the trailing (odd) half.
+	Failed []int
+}
+
+func (e *ParityError) Error() string {
+	return fmt.Sprintf("Invalid parity for %s tag: %d (%d)", e.Format, e.Tag, e.Site)
+}
+
+// UnknownLengthError reports a frame whose length matches no Format.
+type UnknownLengthError struct {
+	Reader string // Name of the Reader that received the frame
+	Bits   []byte // Raw frame bits
+}
+
+func (e *UnknownLengthError) Error() string {
+	return fmt.Sprintf("Received unknown %d-bit value", len(e.Bits))
+}
+
+// KeyError reports a keypad burst which does not encode a valid key.
+type KeyError struct {
+	Reader string // Name of the Reader that received the burst
+	Bits   []byte // Raw burst bits
+	Reason string // Why the burst is invalid
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("invalid %d-bit keypad burst %v: %s", len(e.Bits), e.Bits, e.Reason)
+}
+
+// PINTimeoutError reports a partially entered PIN discarded after the
+// keypad's inter-key timeout.
+type PINTimeoutError struct {
+	Reader string // Name of the Reader the PIN was being entered on
+	Digits int    // Number of digits entered before the timeout
+}
+
+func (e *PINTimeoutError) Error() string {
+	return fmt.Sprintf("PIN entry timed out after %d digits", e.Digits)
+}
+
+// LineError reports the failure of the edge source for a data line. The
+// Reader stops receiving from that line.
+type LineError struct {
+	Reader string // Name of the Reader
+	Line   int    // 0 for D0, 1 for D1
+	Err    error  // Error returned by the EdgeSource
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("D%d line failed: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error { return e.Err }
+
+// OverflowError reports a frame which grew beyond the Reader's MaxBits. The
+// Reader recovers according to Policy.
+type OverflowError struct {
+	Reader  string         // Name of the Reader that received the frame
+	MaxBits int            // The Reader's MaxBits
+	Bits    []byte         // The MaxBits+1 bits received before the overflow
+	Policy  OverflowPolicy // How the Reader recovered
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("frame exceeded %d bits", e.MaxBits)
+}
+
+// StuckLineError reports bits arriving continuously, without the idle gap
+// which ends a frame, for longer than the Reader's StuckLineTimeout. This
+// usually means a data line is floating, shorted or picking up noise. It is
+// reported once per burst.
+type StuckLineError struct {
+	Reader   string        // Name of the Reader
+	Line     int           // The line with the most edges: 0 for D0, 1 for D1
+	Edges    [2]int        // Edges seen on D0 and D1 during the burst
+	Duration time.Duration // How long the burst had lasted when reported
+}
+
+func (e *StuckLineError) Error() string {
+	return fmt.Sprintf("D%d line stuck: %d edges on D0 and %d on D1 without an idle gap in %v", e.Line, e.Edges[0], e.Edges[1], e.Duration)
+}
+
+// RestartError reports a failed attempt by a Manager to restart a Reader
+// after its data line failed. The Manager keeps trying.
+type RestartError struct {
+	Reader string // Name of the Reader
+	Err    error  // Why New failed
+}
+
+func (e *RestartError) Error() string {
+	return fmt.Sprintf("restarting reader %q: %v", e.Reader, e.Err)
+}
+
+func (e *RestartError) Unwrap() error { return e.Err }
+
+// PassbackError reports a card denied entry to an anti-passback area it has
+// entered without being read leaving. The Manager delivers it in place of
+// the credential's event.
+type PassbackError struct {
+	Reader     string     // Name of the entry Reader
+	Area       string     // Name of the PassbackArea
+	Credential Credential // The denied credential
+}
+
+func (e *PassbackError) Error() string {
+	return fmt.Sprintf("anti-passback: card already inside area %q", e.Area)
+}
@@ -0,0 +1,209 @@
+package wiegand
+
+import (
+	"encoding/json"
+	"iter"
+	"time"
+)
+
+// DefaultEventBuffer is the default capacity of a Reader's event channel.
+const DefaultEventBuffer = 64
+
+// Event is something observed by a Reader. Exactly one of Credential, Key,
+// PIN and Err is set.
+type Event struct {
+	Reader     string      // Name of the Reader
+	Time       time.Time   // When the event occurred
+	Credential *Credential // A decoded card read
+	Key        *Key        // A keypad keypress
+	PIN        *PIN        // A completed keypad PIN
+	Err        error       // A read error, one of the error types in this package
+}
+
+// Backpressure selects what a Reader does with a new event when its event
+// channel is full because events are not consumed quickly enough.
+type Backpressure int
+
+const (
+	// BackpressureDropOldest discards the oldest buffered event to make
+	// room for the new one, so consumers catch up with recent activity.
+	BackpressureDropOldest Backpressure = iota
+	// BackpressureDropNewest discards the new event.
+	BackpressureDropNewest
+	// BackpressureBlock waits for room in the channel. Frames keep being
+	// collected meanwhile, but a consumer which stalls for longer than the
+	// frame timeout can cause frames to run together.
+	// Events emitted while the Reader is closing are dropped if the
+	// channel is full.
+	BackpressureBlock
+)
+
+// Events returns the channel on which the Reader delivers its events in the
+// order they occurred. The channel is closed when the Reader is closed or
+// its context is cancelled. Events dropped under the Reader's Backpressure
+// policy are counted in Stats.DroppedEvents.
+//
+// A Reader configured with any callback consumes its own events to invoke
+// the callbacks, and Events must not be used as well.
+func (r *Reader) Events() <-chan Event {
+	return r.events
+}
+
+// Read returns an iterator over the Reader's events, for use in a range
+// loop. It reads from the same channel as Events, and ends when the Reader
+// is closed or its context is cancelled:
+//
+//	for ev := range reader.Read() {
+//		...
+//	}
+func (r *Reader) Read() iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		for ev := range r.events {
+			if !yield(ev) {
+				return
+			}
+		}
+	}
+}
+
+// emit delivers an event to the event channel according to the Reader's
+// Backpressure policy. r.mu must not be held.
+func (r *Reader) emit(ev Event) {
+	ev.Reader = r.name
+	if ev.Err != nil {
+		r.logError(ev.Err)
+	}
+
+	r.eventsMu.RLock()
+	defer r.eventsMu.RUnlock()
+	if r.eventsClosed {
+		return
+	}
+	switch r.backpressure {
+	case BackpressureBlock:
+		// Once the Reader is closing, a full channel drops the event
+		// rather than waiting for a consumer which may have gone.
+		select {
+		case r.events <- ev:
+			return
+		default:
+		}
+		select {
+		case r.events <- ev:
+		case <-r.ctx.Done():
+			r.countDrop()
+		}
+		return
+	case BackpressureDropNewest:
+		select {
+		case r.events <- ev:
+		default:
+			r.countDrop()
+		}
+		return
+	}
+	for {
+		select {
+		case r.events <- ev:
+			return
+		default:
+		}
+		select {
+		case <-r.events:
+			r.countDrop()
+		default:
+		}
+	}
+}
+
+// countDrop records an event dropped under the Backpressure policy.
+func (r *Reader) countDrop() {
+	r.mu.Lock()
+	r.stats.DroppedEvents++
+	r.mu.Unlock()
+}
+
+// closeEvents closes the event channel once no emit is in progress.
+func (r *Reader) closeEvents() {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	if !r.eventsClosed {
+		r.eventsClosed = true
+		close(r.events)
+	}
+}
+
+// dispatch invokes the configured callbacks for each event, in order, until
+// the event channel is closed.
+func (r *Reader) dispatch() {
+	for ev := range r.events {
+		switch {
+		case ev.Credential != nil:
+			if r.callback != nil {
+				r.callback(*ev.Credential)
+			}
+		case ev.Key != nil:
+			if r.keyCallback != nil {
+				r.keyCallback(*ev.Key)
+			}
+		case ev.PIN != nil:
+			if r.pinCallback != nil {
+				r.pinCallback(*ev.PIN)
+			}
+		case ev.Err != nil:
+			if r.errorCallback != nil {
+				r.errorCallback(ev.Err)
+			}
+		}
+	}
+}
+
+// Type returns "credential", "key", "pin" or "error" according to which of
+// the event's fields is set.
+func (e Event) Type() string {
+	switch {
+	case e.Credential != nil:
+		return "credential"
+	case e.Key != nil:
+		return "key"
+	case e.PIN != nil:
+		return "pin"
+	}
+	return "error"
+}
+
+// MarshalJSON encodes the event as a flat object with a "type" member
+// holding e.Type(). Credential bits are encoded as a string of '0' and '1'.
+func (e Event) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Type   string    `json:"type"`
+		Reader string    `json:"reader,omitempty"`
+		Time   time.Time `json:"time"`
+		Format string    `json:"format,omitempty"`
+		Bits   string    `json:"bits,omitempty"`
+		Site   *uint64   `json:"site,omitempty"`
+		Tag    *uint64   `json:"tag,omitempty"`
+		Key    string    `json:"key,omitempty"`
+		PIN    string    `json:"pin,omitempty"`
+		Error  string    `json:"error,omitempty"`
+		// Duplicate marks a flagged repeat read of a credential.
+		Duplicate bool `json:"duplicate,omitempty"`
+	}{Type: e.Type(), Reader: e.Reader, Time: e.Time}
+	switch {
+	case e.Credential != nil:
+		c := e.Credential
+		v.Format, v.Site, v.Tag, v.Duplicate = c.Format, &c.Site, &c.Tag, c.Duplicate
+		bits := make([]byte, len(c.Bits))
+		for i, b := range c.Bits {
+			bits[i] = '0' + b
+		}
+		v.Bits = string(bits)
+	case e.Key != nil:
+		v.Key = string(e.Key.Key)
+	case e.PIN != nil:
+		v.PIN = e.PIN.Digits
+	case e.Err != nil:
+		v.Error = e.Err.Error()
+	}
+	return json.Marshal(v)
+}
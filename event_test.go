@@ -0,0 +1,44 @@
+package wiegand_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+func TestEventMarshalJSON(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	bits, _ := wiegand.Format26.Encode(15, 54321)
+	tests := []struct {
+		ev   wiegand.Event
+		want string
+	}{
+		{
+			wiegand.Event{Reader: "front", Time: at, Credential: &wiegand.Credential{Format: "26-bit", Bits: bits, Site: 15, Tag: 54321}},
+			`{"type":"credential","reader":"front","time":"2024-05-01T12:00:00Z","format":"26-bit","bits":"10000111111010100001100011","site":15,"tag":54321}`,
+		},
+		{
+			wiegand.Event{Reader: "front", Time: at, Key: &wiegand.Key{Key: '#'}},
+			`{"type":"key","reader":"front","time":"2024-05-01T12:00:00Z","key":"#"}`,
+		},
+		{
+			wiegand.Event{Time: at, PIN: &wiegand.PIN{Digits: "1234"}},
+			`{"type":"pin","time":"2024-05-01T12:00:00Z","pin":"1234"}`,
+		},
+		{
+			wiegand.Event{Time: at, Err: &wiegand.UnknownLengthError{Bits: make([]byte, 12)}},
+			`{"type":"error","time":"2024-05-01T12:00:00Z","error":"Received unknown 12-bit value"}`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(tt.ev)
+		if err != nil {
+			t.Fatalf("Marshal(%+v) error = %v", tt.ev, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Marshal() = %s, want %s", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package wiegand
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// FeedbackConfig configures the LED and beeper control wires of a reader,
+// which Reader.Feedback drives. Either output may be left unconfigured.
+type FeedbackConfig struct {
+	LEDPin, BeeperPin string    // GPIO pin names, opened with PeriphBackend if LED and Beeper are nil
+	LED, Beeper       OutputPin // Already opened output pins (optional)
+	// LEDActiveLow and BeeperActiveLow drive an output low to turn it on,
+	// for wires connected directly to the reader. By default outputs are
+	// driven high to turn them on, as when switching the reader's wire to
+	// ground through a transistor or optocoupler.
+	LEDActiveLow    bool
+	BeeperActiveLow bool
+}
+
+// enabled reports whether any feedback output has been configured.
+func (c FeedbackConfig) enabled() bool {
+	return c.LEDPin != "" || c.BeeperPin != "" || c.LED != nil || c.Beeper != nil
+}
+
+// Step is one interval of a feedback Pattern.
+type Step struct {
+	LED      bool // Drive the LED wire, which on most readers turns the LED green
+	Beep     bool // Sound the beeper
+	Duration time.Duration
+}
+
+// Pattern is a sequence of Steps played on a reader's LED and beeper. Both
+// are turned off when it ends.
+type Pattern struct {
+	Steps []Step
+	// Repeat plays the steps again until another pattern is played or the
+	// Feedback is stopped.
+	Repeat bool
+}
+
+// Patterns for common outcomes.
+var (
+	// PatternGrant shows green for three seconds with a short beep.
+	PatternGrant = Pattern{Steps: []Step{
+		{LED: true, Beep: true, Duration: 200 * time.Millisecond},
+		{LED: true, Duration: 2800 * time.Millisecond},
+	}}
+	// PatternDeny sounds three short beeps.
+	PatternDeny = Pattern{Steps: []Step{
+		{Beep: true, Duration: 150 * time.Millisecond},
+		{Duration: 100 * time.Millisecond},
+		{Beep: true, Duration: 150 * time.Millisecond},
+		{Duration: 100 * time.Millisecond},
+		{Beep: true, Duration: 150 * time.Millisecond},
+	}}
+	// PatternHeldOpen sounds the beeper continuously until stopped.
+	PatternHeldOpen = Pattern{Steps: []Step{{Beep: true, Duration: time.Second}}, Repeat: true}
+)
+
+// Feedback drives the LED and beeper of a reader. Playing a pattern cancels
+// the one in progress. It is safe for concurrent use, and the methods of a
+// nil *Feedback do nothing.
+type Feedback struct {
+	led, beeper OutputPin   // Configured outputs, nil if absent
+	opened      []OutputPin // Outputs opened by newFeedback, released by close
+	ledOn       gpio.Level  // Level turning the LED on
+	beepOn      gpio.Level  // Level turning the beeper on
+	logger      *slog.Logger
+
+	mu     sync.Mutex
+	cancel chan struct{} // Closed to stop the pattern in progress
+	done   chan struct{} // Closed when the pattern in progress has stopped
+	closed bool
+}
+
+// newFeedback opens the configured outputs and turns them off. It returns
+// nil if none are configured.
+func newFeedback(cfg FeedbackConfig, logger *slog.Logger) (*Feedback, error) {
+	if !cfg.enabled() {
+		return nil, nil
+	}
+	f := &Feedback{
+		led:    cfg.LED,
+		beeper: cfg.Beeper,
+		ledOn:  gpio.Level(!cfg.LEDActiveLow),
+		beepOn: gpio.Level(!cfg.BeeperActiveLow),
+		logger: logger,
+	}
+	var err error
+	if f.led == nil && cfg.LEDPin != "" {
+		if f.led, err = (PeriphBackend{}).OpenOutput(cfg.LEDPin, !f.ledOn); err != nil {
+			return nil, fmt.Errorf("failed to configure LED pin %s: %w", cfg.LEDPin, err)
+		}
+		f.opened = append(f.opened, f.led)
+	}
+	if f.beeper == nil && cfg.BeeperPin != "" {
+		if f.beeper, err = (PeriphBackend{}).OpenOutput(cfg.BeeperPin, !f.beepOn); err != nil {
+			f.release()
+			return nil, fmt.Errorf("failed to configure beeper pin %s: %w", cfg.BeeperPin, err)
+		}
+		f.opened = append(f.opened, f.beeper)
+	}
+	f.set(false, false)
+	return f, nil
+}
+
+// Play starts playing a pattern, stopping any pattern in progress. It
+// returns without waiting for the pattern to finish.
+func (f *Feedback) Play(p Pattern) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopLocked()
+	if f.closed || len(p.Steps) == 0 {
+		return
+	}
+	f.cancel, f.done = make(chan struct{}), make(chan struct{})
+	go f.play(p, f.cancel, f.done)
+}
+
+// Stop stops the pattern in progress and turns the LED and beeper off.
+func (f *Feedback) Stop() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopLocked()
+	f.set(false, false)
+}
+
+// close stops the Feedback for good.
+func (f *Feedback) close() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopLocked()
+	f.set(false, false)
+	f.closed = true
+	f.release()
+}
+
+// release releases the outputs opened by newFeedback, so that a restarted
+// Reader can open them again.
+func (f *Feedback) release() {
+	for _, p := range f.opened {
+		if err := releaseOutput(p); err != nil {
+			f.logger.Warn("releasing feedback output", "error", err)
+		}
+	}
+	f.opened = nil
+}
+
+// stopLocked stops the pattern in progress, if any. f.mu must be held.
+func (f *Feedback) stopLocked() {
+	if f.cancel == nil {
+		return
+	}
+	close(f.cancel)
+	<-f.done
+	f.cancel, f.done = nil, nil
+}
+
+// play runs a pattern until it ends or cancel is closed.
+func (f *Feedback) play(p Pattern, cancel, done chan struct{}) {
+	defer close(done)
+	var total time.Duration
+	for _, s := range p.Steps {
+		total += s.Duration
+	}
+	for {
+		for _, s := range p.Steps {
+			f.set(s.LED, s.Beep)
+			timer := time.NewTimer(s.Duration)
+			select {
+			case <-timer.C:
+			case <-cancel:
+				timer.Stop()
+				return
+			}
+		}
+		// A repeating pattern without duration would spin.
+		if !p.Repeat || total <= 0 {
+			break
+		}
+	}
+	f.set(false, false)
+}
+
+// set turns the LED and beeper on or off.
+func (f *Feedback) set(led, beep bool) {
+	if f.led != nil {
+		level := f.ledOn
+		if !led {
+			level = !level
+		}
+		if err := f.led.Out(level); err != nil {
+			f.logger.Warn("driving LED", "error", err)
+		}
+	}
+	if f.beeper != nil {
+		level := f.beepOn
+		if !beep {
+			level = !level
+		}
+		if err := f.beeper.Out(level); err != nil {
+			f.logger.Warn("driving beeper", "error", err)
+		}
+	}
+}
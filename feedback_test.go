@@ -0,0 +1,89 @@
+package wiegand_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+// recorded returns the levels the pin has been driven to so far.
+func (p *recordingPin) recorded() []gpio.Level {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.levels)
+}
+
+func TestFeedbackPattern(t *testing.T) {
+	led, beeper := &recordingPin{}, &recordingPin{}
+	s := newSimReader(t, wiegand.Config{
+		Feedback: wiegand.FeedbackConfig{LED: led, Beeper: beeper, BeeperActiveLow: true},
+	})
+	if err := s.line.SendFrame(wiegand.Format26, 15, 54321); err != nil {
+		t.Fatalf("SendFrame() error = %v", err)
+	}
+	s.credential(t)
+	s.Feedback().Play(wiegand.Pattern{Steps: []wiegand.Step{
+		{LED: true, Beep: true, Duration: 5 * time.Millisecond},
+		{LED: true, Duration: 5 * time.Millisecond},
+	}})
+	time.Sleep(50 * time.Millisecond)
+
+	// Both outputs start off and end off; the beeper is active low.
+	if got, want := led.recorded(), []gpio.Level{gpio.Low, gpio.High, gpio.High, gpio.Low}; !slices.Equal(got, want) {
+		t.Errorf("LED levels = %v, want %v", got, want)
+	}
+	if got, want := beeper.recorded(), []gpio.Level{gpio.High, gpio.Low, gpio.High, gpio.High}; !slices.Equal(got, want) {
+		t.Errorf("beeper levels = %v, want %v", got, want)
+	}
+}
+
+func TestFeedbackCancel(t *testing.T) {
+	led, beeper := &recordingPin{}, &recordingPin{}
+	s := newSimReader(t, wiegand.Config{
+		Feedback: wiegand.FeedbackConfig{LED: led, Beeper: beeper},
+	})
+	f := s.Feedback()
+	f.Play(wiegand.PatternHeldOpen)
+	time.Sleep(10 * time.Millisecond)
+	if got := beeper.recorded(); got[len(got)-1] != gpio.High {
+		t.Fatalf("beeper levels = %v, want on while held open", got)
+	}
+
+	// A new pattern replaces the repeating one.
+	f.Play(wiegand.Pattern{Steps: []wiegand.Step{{LED: true, Duration: 5 * time.Millisecond}}})
+	time.Sleep(30 * time.Millisecond)
+	if got := beeper.recorded(); got[len(got)-1] != gpio.Low {
+		t.Errorf("beeper levels = %v, want off after the next pattern", got)
+	}
+	if got := led.recorded(); !slices.Contains(got, gpio.High) || got[len(got)-1] != gpio.Low {
+		t.Errorf("LED levels = %v, want on then off", got)
+	}
+
+	// Close stops a pattern in progress and leaves the outputs off.
+	f.Play(wiegand.PatternGrant)
+	time.Sleep(10 * time.Millisecond)
+	s.Close()
+	n := len(led.recorded())
+	time.Sleep(20 * time.Millisecond)
+	if got := led.recorded(); len(got) != n || got[n-1] != gpio.Low {
+		t.Errorf("LED levels after Close = %v, want off and unchanged", got)
+	}
+	f.Play(wiegand.PatternGrant)
+	if got := led.recorded(); len(got) != n {
+		t.Errorf("Play() after Close changed the LED: %v", got)
+	}
+}
+
+func TestFeedbackUnconfigured(t *testing.T) {
+	s := newSimReader(t, wiegand.Config{})
+	f := s.Feedback()
+	if f != nil {
+		t.Fatalf("Feedback() = %v, want nil without outputs", f)
+	}
+	f.Play(wiegand.PatternDeny)
+	f.Stop()
+}
@@ -0,0 +1,62 @@
+package wiegand
+
+import "time"
+
+// Stats counts a Reader's activity since it was created.
+type Stats struct {
+	Edges          uint64 `json:"edges"`           // Edges received from the data lines
+	Bits           uint64 `json:"bits"`            // Bits passed on for decoding as frames
+	ShortPulses    uint64 `json:"short_pulses"`    // Pulses rejected as narrower than MinPulseWidth
+	ShortIntervals uint64 `json:"short_intervals"` // Bits rejected as closer than MinBitInterval to the previous bit
+	DroppedEvents  uint64 `json:"dropped_events"`  // Events dropped because the event channel was full
+	Duplicates     uint64 `json:"duplicates"`      // Credentials read again within DuplicateWindow
+}
+
+// glitchFilter sits between a Reader's edge sources and its frames,
+// rejecting edges which cannot be genuine Wiegand data pulses.
+type glitchFilter struct {
+	minInterval time.Duration // Minimum time between the starts of two bits
+	minWidth    time.Duration // Minimum pulse width; requires rising edges
+	pulseStart  [2]Edge       // Falling edge of the pulse in progress on D0 and D1
+	inPulse     [2]bool       // Whether pulseStart holds a pulse awaiting its rising edge
+}
+
+// accept returns the edge which starts a data bit on line bit, if e
+// completes one. With a minimum pulse width a bit is only accepted at the
+// rising edge which ends its pulse, but it is timestamped by its falling edge.
+func (f *glitchFilter) accept(bit byte, e Edge, stats *Stats) (Edge, bool) {
+	if f.minWidth <= 0 {
+		return e, !e.Rising
+	}
+	if !e.Rising {
+		f.pulseStart[bit], f.inPulse[bit] = e, true
+		return Edge{}, false
+	}
+	if !f.inPulse[bit] {
+		return Edge{}, false
+	}
+	start := f.pulseStart[bit]
+	f.inPulse[bit] = false
+	if e.Time.Sub(start.Time) < f.minWidth {
+		stats.ShortPulses++
+		return Edge{}, false
+	}
+	return start, true
+}
+
+// spaced removes the bits of a frame which start sooner than minInterval
+// after the previous remaining bit. The edges of D0 and D1 arrive from
+// separate goroutines, so this is done once the frame is sorted into wire
+// order rather than as each edge arrives.
+func (f *glitchFilter) spaced(rx []rxBit, stats *Stats) []rxBit {
+	out := rx[:0]
+	for _, b := range rx {
+		if f.minInterval > 0 && len(out) > 0 && b.edge.Time.Sub(out[len(out)-1].edge.Time) < f.minInterval {
+			stats.ShortIntervals++
+			continue
+		}
+		out = append(out, b)
+	}
+	stats.Bits += uint64(len(out))
+	return out
+}
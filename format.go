@@ -0,0 +1,272 @@
+package wiegand
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Field is a contiguous range of bits within a Wiegand frame. Bits are
+// numbered from 0 in the order they are received, most significant bit first.
+type Field struct {
+	Start  int // Index of the first bit of the field
+	Length int // Number of bits in the field
+}
+
+// ParityCheck describes a parity bit and the range of bits it covers. The
+// range includes the parity bit itself.
+type ParityCheck struct {
+	Field
+	Bit  int  // Index of the parity bit, within Field
+	Even bool // True for even parity, false for odd parity
+}
+
+// Format describes the layout of a Wiegand frame of a particular bit length.
+type Format struct {
+	Name   string        // Human readable name, e.g. "26-bit"
+	Bits   int           // Total number of bits in the frame
+	Site   Field         // Site (facility) code bits
+	Tag    Field         // Tag (card number) bits
+	Parity []ParityCheck // Parity checks which must all pass
+}
+
+// equal reports whether f and g are the same layout with the same name.
+func (f Format) equal(g Format) bool {
+	return f.Name == g.Name && f.Bits == g.Bits && f.Site == g.Site && f.Tag == g.Tag && slices.Equal(f.Parity, g.Parity)
+}
+
+// Format26 is the standard 26-bit (H10301) layout: even parity, 8-bit site
+// code, 16-bit tag, odd parity.
+var Format26 = Format{
+	Name: "26-bit",
+	Bits: 26,
+	Site: Field{Start: 1, Length: 8},
+	Tag:  Field{Start: 9, Length: 16},
+	Parity: []ParityCheck{
+		{Field: Field{Start: 0, Length: 13}, Bit: 0, Even: true},
+		{Field: Field{Start: 13, Length: 13}, Bit: 25, Even: false},
+	},
+}
+
+// Format34 is the 34-bit (H10306) layout with a 16-bit site code and a
+// 16-bit tag.
+var Format34 = Format{
+	Name: "34-bit",
+	Bits: 34,
+	Site: Field{Start: 1, Length: 16},
+	Tag:  Field{Start: 17, Length: 16},
+	Parity: []ParityCheck{
+		{Field: Field{Start: 0, Length: 17}, Bit: 0, Even: true},
+		{Field: Field{Start: 17, Length: 17}, Bit: 33, Even: false},
+	},
+}
+
+// Format37 is a 37-bit layout with a 19-bit site code and a 16-bit tag.
+var Format37 = Format{
+	Name: "37-bit",
+	Bits: 37,
+	Site: Field{Start: 1, Length: 19},
+	Tag:  Field{Start: 20, Length: 16},
+	Parity: []ParityCheck{
+		{Field: Field{Start: 0, Length: 19}, Bit: 0, Even: true},
+		{Field: Field{Start: 19, Length: 18}, Bit: 36, Even: false},
+	},
+}
+
+// BuiltinFormats returns the formats every Reader understands by default.
+func BuiltinFormats() []Format {
+	return []Format{Format26, Format34, Format37}
+}
+
+// Validate reports whether the format describes a usable frame layout.
+func (f Format) Validate() error {
+	if f.Bits <= 0 {
+		return fmt.Errorf("format %q: bit length must be positive", f.Name)
+	}
+	fields := map[string]Field{"site": f.Site, "tag": f.Tag}
+	for name, field := range fields {
+		if field.Length > 64 {
+			return fmt.Errorf("format %q: %s field is %d bits, at most 64 are supported", f.Name, name, field.Length)
+		}
+		if err := f.checkField(field); err != nil {
+			return fmt.Errorf("format %q: %s field: %w", f.Name, name, err)
+		}
+	}
+	for i, p := range f.Parity {
+		if err := f.checkField(p.Field); err != nil {
+			return fmt.Errorf("format %q: parity check %d: %w", f.Name, i, err)
+		}
+		if p.Bit < p.Start || p.Bit >= p.Start+p.Length {
+			return fmt.Errorf("format %q: parity check %d: parity bit %d is outside its range", f.Name, i, p.Bit)
+		}
+		for name, field := range fields {
+			if p.Bit >= field.Start && p.Bit < field.Start+field.Length {
+				return fmt.Errorf("format %q: parity bit %d overlaps the %s field", f.Name, p.Bit, name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkField reports whether field lies within a frame of this format.
+func (f Format) checkField(field Field) error {
+	if field.Start < 0 || field.Length < 0 {
+		return errors.New("start and length must not be negative")
+	}
+	if field.Start+field.Length > f.Bits {
+		return fmt.Errorf("range (%d to %d) exceeds frame length %d", field.Start, field.Start+field.Length-1, f.Bits)
+	}
+	return nil
+}
+
+// failedParity returns the indexes of the parity checks which fail for bits.
+func (f Format) failedParity(bits []byte) []int {
+	var failed []int
+	for i, p := range f.Parity {
+		if !checkParity(bits, p.Start, p.Length, p.Even) {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
+
+// Decode extracts the site code and tag from a frame of this format. An error
+// is returned if the frame is the wrong length, or a *ParityError if it fails
+// a parity check. Only the Format, Bits, Site and Tag fields of the returned
+// Credential are set.
+func (f Format) Decode(bits []byte) (Credential, error) {
+	if len(bits) != f.Bits {
+		return Credential{}, fmt.Errorf("format %q expects %d bits, got %d", f.Name, f.Bits, len(bits))
+	}
+	site, tag, err := decodeFields(bits, f.Site, f.Tag)
+	if err != nil {
+		return Credential{}, err
+	}
+	if failed := f.failedParity(bits); len(failed) > 0 {
+		return Credential{}, &ParityError{
+			Format: f.Name,
+			Bits:   append([]byte(nil), bits...),
+			Site:   site,
+			Tag:    tag,
+			Failed: failed,
+		}
+	}
+	return Credential{
+		Format: f.Name,
+		Bits:   append([]byte(nil), bits...),
+		Site:   site,
+		Tag:    tag,
+	}, nil
+}
+
+// Encode builds a frame of this format carrying the given site code and tag,
+// with all parity bits set. Bits not covered by any field are left as 0. Parity
+// checks may cover each other's parity bits, as long as some setting of the
+// parity bits satisfies them all.
+func (f Format) Encode(site, tag uint64) ([]byte, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	bits := make([]byte, f.Bits)
+	if err := encodeField(bits, f.Site, site); err != nil {
+		return nil, fmt.Errorf("format %q: site code: %w", f.Name, err)
+	}
+	if err := encodeField(bits, f.Tag, tag); err != nil {
+		return nil, fmt.Errorf("format %q: tag: %w", f.Name, err)
+	}
+	// A check whose range covers another check's parity bit depends on that
+	// bit, so repeat until no parity bit changes. Checks which depend on
+	// each other may never settle.
+	for range len(f.Parity) + 1 {
+		changed := false
+		for _, p := range f.Parity {
+			old := bits[p.Bit]
+			bits[p.Bit] = 0
+			if !checkParity(bits, p.Start, p.Length, p.Even) {
+				bits[p.Bit] = 1
+			}
+			changed = changed || bits[p.Bit] != old
+		}
+		if !changed {
+			return bits, nil
+		}
+	}
+	return nil, fmt.Errorf("format %q: parity checks cannot all be satisfied for %d:%d", f.Name, site, tag)
+}
+
+// encodeField writes v into field of bits, most significant bit first.
+func encodeField(bits []byte, field Field, v uint64) error {
+	if field.Length < 64 && v>>field.Length != 0 {
+		return fmt.Errorf("value %d does not fit in %d bits", v, field.Length)
+	}
+	for i := field.Start + field.Length - 1; i >= field.Start; i-- {
+		bits[i] = byte(v & 1)
+		v >>= 1
+	}
+	return nil
+}
+
+// Registry maps frame bit lengths to formats. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	formats map[int]Format
+}
+
+// NewRegistry returns a Registry holding the built-in formats followed by the
+// given formats. Later formats replace earlier ones with the same bit length.
+func NewRegistry(formats ...Format) (*Registry, error) {
+	r := &Registry{formats: make(map[int]Format)}
+	for _, f := range append(BuiltinFormats(), formats...) {
+		if err := r.Register(f); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds a format to the registry, replacing any existing format with
+// the same bit length.
+func (r *Registry) Register(f Format) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	f.Parity = append([]ParityCheck(nil), f.Parity...)
+	r.mu.Lock()
+	r.formats[f.Bits] = f
+	r.mu.Unlock()
+	return nil
+}
+
+// Lookup returns the format registered for frames of the given bit length.
+func (r *Registry) Lookup(bits int) (Format, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.formats[bits]
+	return f, ok
+}
+
+// ByName returns the registered format with the given name.
+func (r *Registry) ByName(name string) (Format, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range r.formats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// Formats returns all registered formats ordered by bit length.
+func (r *Registry) Formats() []Format {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	formats := make([]Format, 0, len(r.formats))
+	for _, f := range r.formats {
+		formats = append(formats, f)
+	}
+	sort.Slice(formats, func(i, j int) bool { return formats[i].Bits < formats[j].Bits })
+	return formats
+}
@@ -0,0 +1,110 @@
+package wiegand
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuiltinFormatsDecode(t *testing.T) {
+	tests := []struct {
+		format Format
+		site   uint64
+		tag    uint64
+	}{
+		{Format26, 15, 54321},
+		{Format34, 13107, 52428},
+		{Format37, 967, 65535},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format.Name, func(t *testing.T) {
+			bits, err := tt.format.Encode(tt.site, tt.tag)
+			if err != nil {
+				t.Fatalf("Encode(%d, %d) error = %v", tt.site, tt.tag, err)
+			}
+			c, err := tt.format.Decode(bits)
+			if err != nil {
+				t.Fatalf("Decode(%v) error = %v", bits, err)
+			}
+			if c.Site != tt.site || c.Tag != tt.tag || c.Format != tt.format.Name || c.BitCount() != tt.format.Bits {
+				t.Errorf("Decode(%v) = %v, want %s %d:%d", bits, c, tt.format.Name, tt.site, tt.tag)
+			}
+			bits[tt.format.Tag.Start] ^= 1
+			var pe *ParityError
+			if _, err := tt.format.Decode(bits); !errors.As(err, &pe) {
+				t.Errorf("Decode(%v) with a flipped bit error = %v, want *ParityError", bits, err)
+			}
+		})
+	}
+}
+
+func TestEncodeOverlappingParity(t *testing.T) {
+	// The bit 0 check covers the bit 34 parity bit, so bit 34 must be set
+	// first.
+	f := Format{
+		Name: "35-bit custom",
+		Bits: 35,
+		Site: Field{Start: 2, Length: 12},
+		Tag:  Field{Start: 14, Length: 20},
+		Parity: []ParityCheck{
+			{Field: Field{Start: 0, Length: 35}, Bit: 0, Even: false},
+			{Field: Field{Start: 1, Length: 34}, Bit: 34, Even: false},
+		},
+	}
+	for _, v := range []struct{ site, tag uint64 }{{0, 0}, {1, 1}, {4095, 1048575}, {1234, 567890}} {
+		bits, err := f.Encode(v.site, v.tag)
+		if err != nil {
+			t.Fatalf("Encode(%d, %d) error = %v", v.site, v.tag, err)
+		}
+		if c, err := f.Decode(bits); err != nil || c.Site != v.site || c.Tag != v.tag {
+			t.Errorf("Decode(Encode(%d, %d)) = %v, %v", v.site, v.tag, c, err)
+		}
+	}
+
+	// Two checks of opposite parity over the same range cannot both pass.
+	f.Parity = []ParityCheck{
+		{Field: Field{Start: 0, Length: 2}, Bit: 0, Even: true},
+		{Field: Field{Start: 0, Length: 2}, Bit: 1, Even: false},
+	}
+	if bits, err := f.Encode(1, 1); err == nil {
+		t.Errorf("Encode() with contradictory parity = %v, want error", bits)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	custom := Format{
+		Name: "site-26",
+		Bits: 26,
+		Site: Field{Start: 1, Length: 12},
+		Tag:  Field{Start: 13, Length: 12},
+	}
+	r, err := NewRegistry(custom)
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	if f, ok := r.Lookup(26); !ok || f.Name != "site-26" {
+		t.Errorf("Lookup(26) = %q, %v, want site-26", f.Name, ok)
+	}
+	if f, ok := r.Lookup(34); !ok || f.Name != "34-bit" {
+		t.Errorf("Lookup(34) = %q, %v, want 34-bit", f.Name, ok)
+	}
+	if _, ok := r.Lookup(35); ok {
+		t.Errorf("Lookup(35) found a format, want none")
+	}
+	if got := len(r.Formats()); got != 3 {
+		t.Errorf("len(Formats()) = %d, want 3", got)
+	}
+
+	bad := Format{Name: "bad", Bits: 10, Tag: Field{Start: 4, Length: 8}}
+	if err := r.Register(bad); err == nil {
+		t.Errorf("Register(%+v) succeeded, want error for out of range field", bad)
+	}
+	overlap := Format{
+		Name:   "overlap",
+		Bits:   10,
+		Tag:    Field{Start: 1, Length: 9},
+		Parity: []ParityCheck{{Field: Field{Start: 5, Length: 5}, Bit: 9}},
+	}
+	if err := r.Register(overlap); err == nil {
+		t.Errorf("Register(%+v) succeeded, want error for parity bit inside tag", overlap)
+	}
+}
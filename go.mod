@@ -1,6 +1,6 @@
 module github.com/asjoyner/wiegand-go
 
-go 1.22.6
+go 1.23
 
 toolchain go1.23.4
 
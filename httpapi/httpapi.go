@@ -0,0 +1,312 @@
+// Package httpapi serves the events of Wiegand readers over HTTP, for
+// dashboards and other local consumers. A Server is fed with Publish, for
+// example from a wiegand.Manager:
+//
+//	api := httpapi.New(httpapi.Config{Status: manager.Health})
+//	go func() {
+//		for ev := range manager.Read() {
+//			api.Publish(ev)
+//		}
+//	}()
+//	http.ListenAndServe("localhost:8080", api)
+//
+// It serves these endpoints, all returning JSON:
+//
+//	GET /events   Server-Sent Events stream of events as they are published
+//	GET /history  Recent events, oldest first; ?limit=n returns the last n
+//	GET /readers  Status of each reader, from Config.Status
+//	GET /formats  The frame formats readers decode
+//
+// Events are encoded by wiegand.Event.MarshalJSON. Each Server-Sent Event
+// carries the event's type as its event name and a sequence number as its
+// id, so a client reconnecting with Last-Event-ID receives the events it
+// missed, as far as they are still in the history.
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+// DefaultHistory is the default number of recent events a Server keeps.
+const DefaultHistory = 100
+
+// DefaultSubscriberBuffer is the default number of events buffered for each
+// /events client.
+const DefaultSubscriberBuffer = 64
+
+// Config holds configuration for creating a Server.
+type Config struct {
+	History          int                           // Recent events to keep (default DefaultHistory)
+	SubscriberBuffer int                           // Events buffered per stream (default DefaultSubscriberBuffer)
+	Status           func() []wiegand.ReaderHealth // Reports reader status for /readers (optional)
+	Formats          []wiegand.Format              // Formats listed by /formats (default wiegand.BuiltinFormats())
+}
+
+// Server is an http.Handler serving published events. It is safe for
+// concurrent use.
+type Server struct {
+	cfg Config
+	mux *http.ServeMux
+
+	mu      sync.Mutex
+	seq     uint64  // Sequence number of the last published event
+	history []entry // Ring buffer of recent events
+	next    int     // Index in history of the next entry to write
+	subs    map[*subscriber]struct{}
+	closed  bool
+	done    chan struct{} // Closed by Close
+}
+
+// entry is a published event and its sequence number.
+type entry struct {
+	seq uint64
+	ev  wiegand.Event
+}
+
+// subscriber is a connected /events client. A client which falls more than
+// its buffer behind is disconnected, so that Publish never blocks.
+type subscriber struct {
+	events  chan entry
+	dropped chan struct{} // Closed when the client is disconnected for falling behind
+}
+
+// New creates a Server.
+func New(cfg Config) *Server {
+	if cfg.History <= 0 {
+		cfg.History = DefaultHistory
+	}
+	if cfg.SubscriberBuffer <= 0 {
+		cfg.SubscriberBuffer = DefaultSubscriberBuffer
+	}
+	if cfg.Formats == nil {
+		cfg.Formats = wiegand.BuiltinFormats()
+	}
+	s := &Server{
+		cfg:     cfg,
+		mux:     http.NewServeMux(),
+		history: make([]entry, 0, cfg.History),
+		subs:    make(map[*subscriber]struct{}),
+		done:    make(chan struct{}),
+	}
+	s.mux.HandleFunc("GET /events", s.serveEvents)
+	s.mux.HandleFunc("GET /history", s.serveHistory)
+	s.mux.HandleFunc("GET /readers", s.serveReaders)
+	s.mux.HandleFunc("GET /formats", s.serveFormats)
+	return s
+}
+
+// Publish records an event in the history and sends it to every connected
+// /events client.
+func (s *Server) Publish(ev wiegand.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.seq++
+	e := entry{seq: s.seq, ev: ev}
+	if len(s.history) < cap(s.history) {
+		s.history = append(s.history, e)
+	} else {
+		s.history[s.next] = e
+	}
+	s.next = (s.next + 1) % cap(s.history)
+	for sub := range s.subs {
+		select {
+		case sub.events <- e:
+		default:
+			delete(s.subs, sub)
+			close(sub.dropped)
+		}
+	}
+}
+
+// Close ends every /events stream. Events published afterwards are ignored.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// recent returns the entries in the history after seq, oldest first.
+// s.mu must be held.
+func (s *Server) recent(after uint64) []entry {
+	var out []entry
+	start := 0
+	if len(s.history) == cap(s.history) {
+		start = s.next
+	}
+	for i := range s.history {
+		e := s.history[(start+i)%len(s.history)]
+		if e.seq > after {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	after, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+
+	sub := &subscriber{events: make(chan entry, s.cfg.SubscriberBuffer), dropped: make(chan struct{})}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		http.Error(w, "server closed", http.StatusServiceUnavailable)
+		return
+	}
+	var missed []entry
+	if after > 0 {
+		missed = s.recent(after)
+	}
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, sub)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for _, e := range missed {
+		if writeEvent(w, e) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+	for {
+		select {
+		case e := <-sub.events:
+			if writeEvent(w, e) != nil || rc.Flush() != nil {
+				return
+			}
+		case <-sub.dropped:
+			return
+		case <-s.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes one Server-Sent Event.
+func writeEvent(w http.ResponseWriter, e entry) error {
+	data, err := json.Marshal(e.ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.seq, e.ev.Type(), data)
+	return err
+}
+
+func (s *Server) serveHistory(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	entries := s.recent(0)
+	s.mu.Unlock()
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		entries = entries[max(0, len(entries)-n):]
+	}
+	events := make([]wiegand.Event, len(entries))
+	for i, e := range entries {
+		events[i] = e.ev
+	}
+	writeJSON(w, events)
+}
+
+// readerStatus is the JSON form of a wiegand.ReaderHealth.
+type readerStatus struct {
+	Name      string        `json:"name"`
+	Running   bool          `json:"running"`
+	Restarts  int           `json:"restarts"`
+	LastError string        `json:"last_error,omitempty"`
+	LastEvent *time.Time    `json:"last_event,omitempty"`
+	Stats     wiegand.Stats `json:"stats"`
+}
+
+func (s *Server) serveReaders(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Status == nil {
+		http.Error(w, "reader status not available", http.StatusNotFound)
+		return
+	}
+	health := s.cfg.Status()
+	readers := make([]readerStatus, len(health))
+	for i, h := range health {
+		readers[i] = readerStatus{Name: h.Name, Running: h.Running, Restarts: h.Restarts, Stats: h.Stats}
+		if h.LastError != nil {
+			readers[i].LastError = h.LastError.Error()
+		}
+		if !h.LastEvent.IsZero() {
+			readers[i].LastEvent = &h.LastEvent
+		}
+	}
+	writeJSON(w, readers)
+}
+
+// Types giving wiegand.Format a JSON form.
+type (
+	fieldJSON struct {
+		Start  int `json:"start"`
+		Length int `json:"length"`
+	}
+	parityJSON struct {
+		Start  int  `json:"start"`
+		Length int  `json:"length"`
+		Bit    int  `json:"bit"`
+		Even   bool `json:"even"`
+	}
+	formatJSON struct {
+		Name   string       `json:"name"`
+		Bits   int          `json:"bits"`
+		Site   fieldJSON    `json:"site"`
+		Tag    fieldJSON    `json:"tag"`
+		Parity []parityJSON `json:"parity"`
+	}
+)
+
+func (s *Server) serveFormats(w http.ResponseWriter, r *http.Request) {
+	formats := make([]formatJSON, len(s.cfg.Formats))
+	for i, f := range s.cfg.Formats {
+		formats[i] = formatJSON{
+			Name:   f.Name,
+			Bits:   f.Bits,
+			Site:   fieldJSON(f.Site),
+			Tag:    fieldJSON(f.Tag),
+			Parity: make([]parityJSON, len(f.Parity)),
+		}
+		for j, p := range f.Parity {
+			formats[i].Parity[j] = parityJSON{Start: p.Start, Length: p.Length, Bit: p.Bit, Even: p.Even}
+		}
+	}
+	writeJSON(w, formats)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
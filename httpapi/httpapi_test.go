@@ -0,0 +1,171 @@
+package httpapi_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+	"github.com/asjoyner/wiegand-go/httpapi"
+	"github.com/asjoyner/wiegand-go/wiegandtest"
+)
+
+// newTestServer serves the events of a Manager with one simulated reader,
+// "door".
+func newTestServer(t *testing.T) (*httptest.Server, *wiegandtest.Line) {
+	t.Helper()
+	line := wiegandtest.NewLine()
+	line.Interval = time.Millisecond
+	m, err := wiegand.NewManager(context.Background(), wiegand.ManagerConfig{
+		Readers: []wiegand.ReaderDef{{Name: "door", D0Pin: "door/D0", D1Pin: "door/D1"}},
+		Reader:  wiegand.Config{Backend: wiegandtest.Lines{"door": line}, Timeout: 20 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	api := httpapi.New(httpapi.Config{Status: m.Health})
+	go func() {
+		for ev := range m.Read() {
+			api.Publish(ev)
+		}
+	}()
+	ts := httptest.NewServer(api)
+	t.Cleanup(func() {
+		api.Close()
+		ts.Close()
+		m.Close()
+	})
+	return ts, line
+}
+
+// sseEvent is one parsed Server-Sent Event.
+type sseEvent struct {
+	id, event, data string
+}
+
+// readEvent reads the next event from a Server-Sent Events stream.
+func readEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return ev
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			ev.id = value
+		case "event":
+			ev.event = value
+		case "data":
+			ev.data = value
+		}
+	}
+}
+
+func getJSON(t *testing.T, url string, v any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: decoding: %v", url, err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ts, line := newTestServer(t)
+	resp, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	stream := bufio.NewReader(resp.Body)
+
+	if err := line.SendFrame(wiegand.Format26, 15, 54321); err != nil {
+		t.Fatalf("SendFrame() error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	bad, _ := wiegand.Format26.Encode(15, 54321)
+	if err := line.Send(bad[1:]); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	ev := readEvent(t, stream)
+	if ev.id != "1" || ev.event != "credential" || !strings.Contains(ev.data, `"reader":"door"`) || !strings.Contains(ev.data, `"tag":54321`) {
+		t.Errorf("first event = %+v, want credential 54321 from door", ev)
+	}
+	ev = readEvent(t, stream)
+	if ev.id != "2" || ev.event != "error" || !strings.Contains(ev.data, "unknown 25-bit value") {
+		t.Errorf("second event = %+v, want unknown length error", ev)
+	}
+
+	// A client reconnecting after the first event is sent the second again.
+	req, _ := http.NewRequest("GET", ts.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	defer resp2.Body.Close()
+	if ev := readEvent(t, bufio.NewReader(resp2.Body)); ev.id != "2" {
+		t.Errorf("replayed event = %+v, want id 2", ev)
+	}
+
+	var history []map[string]any
+	getJSON(t, ts.URL+"/history?limit=1", &history)
+	if len(history) != 1 || history[0]["type"] != "error" {
+		t.Errorf("/history?limit=1 = %v, want the error", history)
+	}
+	getJSON(t, ts.URL+"/history", &history)
+	if len(history) != 2 || history[0]["type"] != "credential" {
+		t.Errorf("/history = %v, want credential then error", history)
+	}
+}
+
+func TestReadersAndFormats(t *testing.T) {
+	ts, line := newTestServer(t)
+	if err := line.SendFrame(wiegand.Format34, 1, 2); err != nil {
+		t.Fatalf("SendFrame() error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	var readers []struct {
+		Name    string
+		Running bool
+		Stats   struct {
+			Bits int
+		}
+	}
+	getJSON(t, ts.URL+"/readers", &readers)
+	if len(readers) != 1 || readers[0].Name != "door" || !readers[0].Running || readers[0].Stats.Bits != 34 {
+		t.Errorf("/readers = %+v, want door running with 34 bits read", readers)
+	}
+
+	var formats []struct {
+		Name string
+		Bits int
+	}
+	getJSON(t, ts.URL+"/formats", &formats)
+	if len(formats) != 3 || formats[0].Bits != 26 || formats[2].Name != "37-bit" {
+		t.Errorf("/formats = %+v, want the built-in formats", formats)
+	}
+}
@@ -0,0 +1,169 @@
+package wiegand
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultInterKeyTimeout is the default time allowed between keypresses
+// before a partially entered PIN is discarded.
+const DefaultInterKeyTimeout = 5 * time.Second
+
+// Key is a single keypress received from a Wiegand keypad.
+type Key struct {
+	Reader string    // Name of the Reader that received the keypress
+	Key    rune      // '0' to '9', '*' or '#'
+	Time   time.Time // Time the keypress was received
+}
+
+// PIN is a sequence of digits entered on a Wiegand keypad.
+type PIN struct {
+	Reader string    // Name of the Reader that received the PIN
+	Digits string    // Digits entered, excluding the terminator
+	Time   time.Time // Time the last key of the PIN was received
+}
+
+// KeypadConfig configures decoding of keypad bursts. Keypads send each
+// keypress as a 4-bit burst (the key code) or an 8-bit burst (the complement
+// of the key code followed by the key code). Key codes 0 to 9 are digits, 10
+// is '*' and 11 is '#'. Keypad decoding is enabled when Enabled, KeyCallback
+// or PINCallback is set, and then takes precedence over any 4 or 8-bit Format.
+type KeypadConfig struct {
+	// Enabled decodes keypad bursts without callbacks, for consumers of
+	// Reader.Events.
+	Enabled     bool
+	KeyCallback func(Key) // Receives every keypress (optional)
+	PINCallback func(PIN) // Receives each completed PIN (optional)
+	Terminator  rune      // Key which completes a PIN (default '#')
+	Clear       rune      // Key which discards the digits entered so far (default '*')
+	// MaxLength completes a PIN as soon as this many digits have been
+	// entered, without waiting for the terminator. Zero means no limit.
+	MaxLength int
+	// InterKeyTimeout discards a partially entered PIN if no key is
+	// pressed for this long (default DefaultInterKeyTimeout).
+	InterKeyTimeout time.Duration
+}
+
+// enabled reports whether keypad decoding has been requested.
+func (c KeypadConfig) enabled() bool {
+	return c.Enabled || c.KeyCallback != nil || c.PINCallback != nil
+}
+
+// decodeKey decodes a 4 or 8-bit keypad burst into its key. An invalid burst
+// yields a KeyError with only Bits and Reason set.
+func decodeKey(bits []byte) (rune, *KeyError) {
+	var v byte
+	for _, b := range bits {
+		v = v<<1 | b
+	}
+	code := v & 0x0f
+	if len(bits) == 8 && v>>4 != ^code&0x0f {
+		return 0, &KeyError{Bits: bits, Reason: "high nibble is not the complement of the low nibble"}
+	}
+	switch {
+	case code <= 9:
+		return rune('0' + code), nil
+	case code == 10:
+		return '*', nil
+	case code == 11:
+		return '#', nil
+	}
+	return 0, &KeyError{Bits: bits, Reason: fmt.Sprintf("unknown key code %d", code)}
+}
+
+// pinAssembler collects keypresses from one Reader into PINs.
+type pinAssembler struct {
+	cfg    KeypadConfig
+	emit   func(Event) // Delivers keypresses, PINs and PIN entry timeouts
+	mu     sync.Mutex
+	digits []rune
+	reader string      // Reader the digits were entered on
+	timer  *time.Timer // Fires after InterKeyTimeout of inactivity
+}
+
+func newPINAssembler(cfg KeypadConfig, emit func(Event)) *pinAssembler {
+	if cfg.Terminator == 0 {
+		cfg.Terminator = '#'
+	}
+	if cfg.Clear == 0 {
+		cfg.Clear = '*'
+	}
+	if cfg.InterKeyTimeout <= 0 {
+		cfg.InterKeyTimeout = DefaultInterKeyTimeout
+	}
+	return &pinAssembler{cfg: cfg, emit: emit}
+}
+
+// press handles a keypress, delivering a PIN when one is complete.
+func (p *pinAssembler) press(k Key) {
+	p.emit(Event{Time: k.Time, Key: &k})
+	if pin := p.add(k); pin != nil {
+		p.emit(Event{Time: k.Time, PIN: pin})
+	}
+}
+
+// add adds a keypress to the digits entered so far, returning the PIN it
+// completes, if any. The PIN is emitted by the caller once p.mu is
+// released, so that the event consumer may call back into the Reader.
+func (p *pinAssembler) add(k Key) *PIN {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopTimer()
+	switch {
+	case k.Key == p.cfg.Clear:
+		p.digits = p.digits[:0]
+		return nil
+	case k.Key == p.cfg.Terminator:
+		return p.complete(k)
+	case k.Key < '0' || k.Key > '9':
+		return nil
+	}
+	p.digits = append(p.digits, k.Key)
+	p.reader = k.Reader
+	if p.cfg.MaxLength > 0 && len(p.digits) >= p.cfg.MaxLength {
+		return p.complete(k)
+	}
+	p.timer = time.AfterFunc(p.cfg.InterKeyTimeout, p.expire)
+	return nil
+}
+
+// complete returns the digits entered so far, if any, as a PIN and starts a
+// new one. p.mu must be held.
+func (p *pinAssembler) complete(k Key) *PIN {
+	var pin *PIN
+	if len(p.digits) > 0 {
+		pin = &PIN{Reader: k.Reader, Digits: string(p.digits), Time: k.Time}
+	}
+	p.digits = p.digits[:0]
+	return pin
+}
+
+// expire discards a partially entered PIN after the inter-key timeout.
+func (p *pinAssembler) expire() {
+	p.mu.Lock()
+	n := len(p.digits)
+	p.digits = p.digits[:0]
+	p.timer = nil
+	reader := p.reader
+	p.mu.Unlock()
+	if n > 0 {
+		p.emit(Event{Time: time.Now(), Err: &PINTimeoutError{Reader: reader, Digits: n}})
+	}
+}
+
+// stop discards any partially entered PIN and its inter-key timeout.
+func (p *pinAssembler) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopTimer()
+	p.digits = p.digits[:0]
+}
+
+// stopTimer cancels a pending inter-key timeout. p.mu must be held.
+func (p *pinAssembler) stopTimer() {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+}
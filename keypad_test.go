@@ -0,0 +1,110 @@
+package wiegand_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+// keyBurst returns the bits of a keypad burst for key code k, in the 4-bit
+// form or the 8-bit form with the complement nibble first.
+func keyBurst(k byte, eightBit bool) []byte {
+	v, n := k, 4
+	if eightBit {
+		v, n = (^k&0x0f)<<4|k, 8
+	}
+	bits := make([]byte, n)
+	for i := range bits {
+		bits[i] = (v >> (n - 1 - i)) & 1
+	}
+	return bits
+}
+
+func TestKeypadPIN(t *testing.T) {
+	for _, eightBit := range []bool{false, true} {
+		name := "4-bit"
+		if eightBit {
+			name = "8-bit"
+		}
+		t.Run(name, func(t *testing.T) {
+			pins := make(chan wiegand.PIN, 1)
+			keys := make(chan wiegand.Key, 10)
+			s := newSimReader(t, wiegand.Config{
+				Name: "keypad",
+				Keypad: wiegand.KeypadConfig{
+					KeyCallback: func(k wiegand.Key) { keys <- k },
+					PINCallback: func(p wiegand.PIN) { pins <- p },
+				},
+			})
+			// 9, *, 1, 2, 3, 4, #: the clear key discards the 9.
+			for _, k := range []byte{9, 10, 1, 2, 3, 4, 11} {
+				if err := s.line.Send(keyBurst(k, eightBit)); err != nil {
+					t.Fatalf("Send() error = %v", err)
+				}
+				time.Sleep(30 * time.Millisecond)
+			}
+			select {
+			case p := <-pins:
+				if p.Reader != "keypad" || p.Digits != "1234" {
+					t.Errorf("got PIN %+v, want keypad 1234", p)
+				}
+			case err := <-s.errs:
+				t.Fatalf("got error %v, want PIN", err)
+			case <-time.After(time.Second):
+				t.Fatal("timed out waiting for PIN")
+			}
+			var got []rune
+			for len(got) < 7 {
+				select {
+				case k := <-keys:
+					got = append(got, k.Key)
+				case <-time.After(time.Second):
+					t.Fatalf("got keypresses %q, want 7", got)
+				}
+			}
+		})
+	}
+}
+
+func TestKeypadMaxLengthAndTimeout(t *testing.T) {
+	pins := make(chan wiegand.PIN, 1)
+	s := newSimReader(t, wiegand.Config{
+		Keypad: wiegand.KeypadConfig{
+			PINCallback:     func(p wiegand.PIN) { pins <- p },
+			MaxLength:       2,
+			InterKeyTimeout: 100 * time.Millisecond,
+		},
+	})
+
+	s.line.Send(keyBurst(7, false))
+	var pte *wiegand.PINTimeoutError
+	if err := s.error(t); !errors.As(err, &pte) || pte.Digits != 1 {
+		t.Errorf("got error %v, want PIN timeout after 1 digit", err)
+	}
+
+	for _, k := range []byte{5, 6} {
+		s.line.Send(keyBurst(k, false))
+		time.Sleep(30 * time.Millisecond)
+	}
+	select {
+	case p := <-pins:
+		if p.Digits != "56" {
+			t.Errorf("got PIN %q, want 56", p.Digits)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for PIN")
+	}
+}
+
+func TestKeypadInvalidBurst(t *testing.T) {
+	s := newSimReader(t, wiegand.Config{
+		Keypad: wiegand.KeypadConfig{PINCallback: func(wiegand.PIN) {}},
+	})
+	s.line.Send([]byte{0, 0, 0, 0, 0, 0, 0, 1})
+	var ke *wiegand.KeyError
+	if err := s.error(t); !errors.As(err, &ke) || len(ke.Bits) != 8 {
+		t.Errorf("got error %v, want invalid 8-bit burst", err)
+	}
+}
@@ -0,0 +1,52 @@
+package wiegand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// discardHandler is the slog.Handler behind Readers without a Logger.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// redacted replaces credential numbers, raw bits and keys in log messages.
+const redacted = "[redacted]"
+
+// credentialAttrs describes a decoded credential for logging.
+func (r *Reader) credentialAttrs(c Credential) []any {
+	attrs := []any{"format", c.Format}
+	if r.logCredentials {
+		return append(attrs, "site", c.Site, "tag", c.Tag, "bits", c.Bits)
+	}
+	return append(attrs, "site", redacted, "tag", redacted)
+}
+
+// logError logs a read error as it is emitted.
+func (r *Reader) logError(err error) {
+	r.logger.Warn("read error", "error", r.redactError(err))
+}
+
+// redactError returns err, or a description of it without the credential
+// numbers or key codes it carries unless the Reader logs credentials.
+func (r *Reader) redactError(err error) any {
+	if r.logCredentials {
+		return err
+	}
+	var (
+		pe *ParityError
+		ke *KeyError
+	)
+	switch {
+	case errors.As(err, &pe):
+		return fmt.Sprintf("Invalid parity for %s tag: %s", pe.Format, redacted)
+	case errors.As(err, &ke):
+		return fmt.Sprintf("invalid %d-bit keypad burst: %s", len(ke.Bits), redacted)
+	}
+	return err
+}
@@ -0,0 +1,343 @@
+package wiegand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultRestartDelay is the default time a Manager waits before restarting
+// a failed Reader, and between failed restart attempts.
+const DefaultRestartDelay = time.Second
+
+// ReaderDef defines one Reader run by a Manager.
+type ReaderDef struct {
+	Name         string         // Identifies the reader in events; must be unique
+	D0Pin, D1Pin string         // GPIO pin names
+	Formats      []Format       // Formats added to the Manager's Reader.Formats
+	Timeout      time.Duration  // Overrides the Manager's Reader.Timeout if set
+	Feedback     FeedbackConfig // LED and beeper of this reader (optional)
+}
+
+// ManagerConfig holds configuration for creating a Manager.
+type ManagerConfig struct {
+	// Readers defines the readers to run.
+	Readers []ReaderDef
+	// Reader is the configuration shared by every reader, such as the
+	// Backend, Formats, Keypad and Logger. The name, pins, formats and
+	// timeout of each ReaderDef are applied on top of it. Callbacks are
+	// ignored: the Manager consumes the readers' events, which are read
+	// from Manager.Events or Manager.Read instead. Feedback is ignored too,
+	// as each reader has its own outputs: set ReaderDef.Feedback.
+	Reader Config
+	// RestartDelay is how long to wait before restarting a reader whose
+	// data line failed (default DefaultRestartDelay).
+	RestartDelay time.Duration
+	// EventBuffer is the capacity of the Manager's event channel (default
+	// DefaultEventBuffer). While it is full, events back up into each
+	// reader's own channel, subject to Reader.Backpressure.
+	EventBuffer int
+	// Passback defines anti-passback areas over the readers. A credential
+	// entering an area it is already inside is replaced by a
+	// *PassbackError event. Credentials flagged as Duplicate are passed on
+	// without being checked or recorded. It requires Reader.DuplicateWindow,
+	// as otherwise the repeated frames of a card held against an entry
+	// reader would be denied as a second entry. Optional.
+	//
+	// A card is recorded entering or leaving as its credential is
+	// delivered, before anything consuming the events decides whether to
+	// grant access. Call ResetPassback for a card denied at an entry
+	// reader, so that it is not held inside an area it never entered.
+	Passback []PassbackArea
+}
+
+// ReaderHealth describes the state of one of a Manager's readers.
+type ReaderHealth struct {
+	Name      string    // Name of the reader
+	Running   bool      // False while waiting to be restarted
+	Restarts  int       // Times the reader has been restarted
+	LastError error     // Latest error reported by the reader, if any
+	LastEvent time.Time // When the reader last delivered an event
+	Stats     Stats     // Counters of the running Reader
+}
+
+// Manager runs several Readers with a shared configuration, merging their
+// events into one stream. A Reader whose data line fails, reported with a
+// *LineError, is closed and restarted after RestartDelay.
+type Manager struct {
+	cfg    ManagerConfig
+	events chan Event
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup // Tracks the goroutine running each reader
+
+	mu       sync.Mutex // Protects readers and their fields, and passback
+	readers  []*managedReader
+	errs     []error   // Errors from closing readers
+	passback *passback // Cards inside each PassbackArea
+}
+
+// managedReader is the state of one of a Manager's readers.
+type managedReader struct {
+	def       ReaderDef
+	reader    *Reader // Nil while waiting to be restarted
+	restarts  int
+	lastError error
+	lastEvent time.Time
+}
+
+// NewManager starts a Reader for each definition in cfg. If any of them
+// cannot be started, those already started are closed and the error is
+// returned.
+func NewManager(ctx context.Context, cfg ManagerConfig) (*Manager, error) {
+	if len(cfg.Readers) == 0 {
+		return nil, errors.New("no readers defined")
+	}
+	names := make(map[string]bool)
+	for _, def := range cfg.Readers {
+		if def.Name == "" {
+			return nil, errors.New("every reader must have a name")
+		}
+		if names[def.Name] {
+			return nil, fmt.Errorf("duplicate reader name %q", def.Name)
+		}
+		names[def.Name] = true
+	}
+	if len(cfg.Passback) > 0 && cfg.Reader.DuplicateWindow <= 0 {
+		return nil, errors.New("anti-passback requires Reader.DuplicateWindow")
+	}
+	pb, err := newPassback(cfg.Passback, names)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RestartDelay <= 0 {
+		cfg.RestartDelay = DefaultRestartDelay
+	}
+	if cfg.EventBuffer <= 0 {
+		cfg.EventBuffer = DefaultEventBuffer
+	}
+
+	m := &Manager{cfg: cfg, events: make(chan Event, cfg.EventBuffer), passback: pb}
+	m.ctx, m.cancel = context.WithCancel(ctx)
+	for _, def := range cfg.Readers {
+		r, err := New(m.ctx, m.readerConfig(def))
+		if err != nil {
+			m.cancel()
+			for _, mr := range m.readers {
+				mr.reader.Close()
+			}
+			return nil, fmt.Errorf("reader %q: %w", def.Name, err)
+		}
+		m.readers = append(m.readers, &managedReader{def: def, reader: r})
+	}
+	m.wg.Add(len(m.readers))
+	for _, mr := range m.readers {
+		go m.run(mr)
+	}
+	go func() {
+		m.wg.Wait()
+		close(m.events)
+	}()
+	return m, nil
+}
+
+// readerConfig returns the Config for the reader defined by def.
+func (m *Manager) readerConfig(def ReaderDef) Config {
+	cfg := m.cfg.Reader
+	cfg.Name, cfg.D0Pin, cfg.D1Pin = def.Name, def.D0Pin, def.D1Pin
+	cfg.Formats = append(append([]Format(nil), cfg.Formats...), def.Formats...)
+	if def.Timeout > 0 {
+		cfg.Timeout = def.Timeout
+	}
+	cfg.Feedback = def.Feedback
+	cfg.Keypad.Enabled = cfg.Keypad.enabled()
+	cfg.CredentialCallback, cfg.Callback = nil, nil
+	cfg.ErrorHandler, cfg.ErrorCallback = nil, nil
+	cfg.Keypad.KeyCallback, cfg.Keypad.PINCallback = nil, nil
+	return cfg
+}
+
+// run forwards the events of one reader, restarting it when its data line
+// fails, until the Manager is closed.
+func (m *Manager) run(mr *managedReader) {
+	defer m.wg.Done()
+	for {
+		m.mu.Lock()
+		r := mr.reader
+		m.mu.Unlock()
+		m.forward(mr, r)
+		err := r.Close()
+
+		m.mu.Lock()
+		mr.reader = nil
+		if err != nil {
+			m.errs = append(m.errs, fmt.Errorf("reader %q: %w", mr.def.Name, err))
+		}
+		m.mu.Unlock()
+		if !m.restart(mr) {
+			return
+		}
+	}
+}
+
+// forward passes the events of r on to the Manager's channel until r's
+// data line fails or r is closed.
+func (m *Manager) forward(mr *managedReader, r *Reader) {
+	for ev := range r.Events() {
+		m.mu.Lock()
+		mr.lastEvent = ev.Time
+		if ev.Err != nil {
+			mr.lastError = ev.Err
+		}
+		if c := ev.Credential; c != nil && !c.Duplicate {
+			if err := m.passback.check(*c); err != nil {
+				ev = Event{Reader: ev.Reader, Time: ev.Time, Err: err}
+			}
+		}
+		m.mu.Unlock()
+		if !m.send(ev) {
+			return
+		}
+		var le *LineError
+		if errors.As(ev.Err, &le) {
+			return
+		}
+	}
+}
+
+// restart starts a new Reader for mr after RestartDelay, retrying until it
+// succeeds. It returns false if the Manager was closed first.
+func (m *Manager) restart(mr *managedReader) bool {
+	for {
+		select {
+		case <-m.ctx.Done():
+			return false
+		case <-time.After(m.cfg.RestartDelay):
+		}
+		r, err := New(m.ctx, m.readerConfig(mr.def))
+		m.mu.Lock()
+		if err == nil {
+			mr.reader = r
+			mr.restarts++
+			m.mu.Unlock()
+			return true
+		}
+		err = &RestartError{Reader: mr.def.Name, Err: err}
+		mr.lastError = err
+		m.mu.Unlock()
+		if !m.send(Event{Reader: mr.def.Name, Time: time.Now(), Err: err}) {
+			return false
+		}
+	}
+}
+
+// send delivers an event on the Manager's channel, returning false if the
+// Manager was closed first.
+func (m *Manager) send(ev Event) bool {
+	select {
+	case m.events <- ev:
+		return true
+	case <-m.ctx.Done():
+		return false
+	}
+}
+
+// Events returns the channel on which the Manager delivers the events of
+// all its readers. Each event's Reader field names the reader it came from.
+// The channel is closed once the Manager is closed.
+func (m *Manager) Events() <-chan Event {
+	return m.events
+}
+
+// Read returns an iterator over the Manager's events, for use in a range
+// loop. It ends when the Manager is closed.
+func (m *Manager) Read() iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		for ev := range m.events {
+			if !yield(ev) {
+				return
+			}
+		}
+	}
+}
+
+// ResetPassback forgets that the card with the given format name, site code
+// and tag is inside any anti-passback area, so that it may enter again. Use
+// it when a card was denied access after being read at an entry reader, or
+// left without being read.
+func (m *Manager) ResetPassback(format string, site, tag uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.passback.reset(format, site, tag)
+}
+
+// Feedback returns the Feedback of the named reader. It returns nil, whose
+// methods do nothing, if the reader has no feedback outputs, is not known,
+// or is waiting to be restarted; a restarted reader has a new Feedback.
+func (m *Manager) Feedback(name string) *Feedback {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, mr := range m.readers {
+		if mr.def.Name == name && mr.reader != nil {
+			return mr.reader.Feedback()
+		}
+	}
+	return nil
+}
+
+// Health returns the state of each reader, in the order they were defined.
+func (m *Manager) Health() []ReaderHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	health := make([]ReaderHealth, len(m.readers))
+	for i, mr := range m.readers {
+		health[i] = ReaderHealth{
+			Name:      mr.def.Name,
+			Running:   mr.reader != nil,
+			Restarts:  mr.restarts,
+			LastError: mr.lastError,
+			LastEvent: mr.lastEvent,
+		}
+		if mr.reader != nil {
+			health[i].Stats = mr.reader.Stats()
+		}
+	}
+	return health
+}
+
+// Formats returns the formats decoded by any of the readers, ordered by bit
+// length. A format used by several readers is listed once.
+func (m *Manager) Formats() []Format {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var formats []Format
+	for _, mr := range m.readers {
+		var fs []Format
+		if mr.reader != nil {
+			fs = mr.reader.Formats()
+		} else if r, err := NewRegistry(m.readerConfig(mr.def).Formats...); err == nil {
+			fs = r.Formats() // Waiting to be restarted with the same formats
+		}
+		for _, f := range fs {
+			if !slices.ContainsFunc(formats, f.equal) {
+				formats = append(formats, f)
+			}
+		}
+	}
+	slices.SortStableFunc(formats, func(a, b Format) int { return a.Bits - b.Bits })
+	return formats
+}
+
+// Close closes every reader and waits for them to stop. It returns the
+// errors from closing the readers' pins.
+func (m *Manager) Close() error {
+	m.cancel()
+	m.wg.Wait()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return errors.Join(m.errs...)
+}
@@ -0,0 +1,249 @@
+package wiegand_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+
+	"github.com/asjoyner/wiegand-go"
+	"github.com/asjoyner/wiegand-go/wiegandtest"
+)
+
+func newTestManager(t *testing.T, names ...string) (*wiegand.Manager, wiegandtest.Lines) {
+	t.Helper()
+	return newTestManagerConfig(t, wiegand.ManagerConfig{}, names...)
+}
+
+// newTestManagerConfig starts a Manager with cfg and a simulated reader for
+// each name.
+func newTestManagerConfig(t *testing.T, cfg wiegand.ManagerConfig, names ...string) (*wiegand.Manager, wiegandtest.Lines) {
+	t.Helper()
+	lines := make(wiegandtest.Lines)
+	for _, name := range names {
+		lines[name] = wiegandtest.NewLine()
+		lines[name].Interval = time.Millisecond
+		cfg.Readers = append(cfg.Readers, wiegand.ReaderDef{Name: name, D0Pin: name + "/D0", D1Pin: name + "/D1"})
+	}
+	cfg.Reader.Backend, cfg.Reader.Timeout = lines, 20*time.Millisecond
+	cfg.RestartDelay = 10 * time.Millisecond
+	m, err := wiegand.NewManager(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m, lines
+}
+
+// nextEvent returns the next event from m, failing the test after a second.
+func nextEvent(t *testing.T, m *wiegand.Manager) wiegand.Event {
+	t.Helper()
+	select {
+	case ev := <-m.Events():
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return wiegand.Event{}
+}
+
+func TestManagerEvents(t *testing.T) {
+	m, lines := newTestManager(t, "front", "back")
+	for _, name := range []string{"back", "front"} {
+		if err := lines[name].SendFrame(wiegand.Format26, 1, 42); err != nil {
+			t.Fatalf("SendFrame() error = %v", err)
+		}
+		ev := nextEvent(t, m)
+		if ev.Reader != name || ev.Credential == nil || ev.Credential.Reader != name {
+			t.Errorf("got event %+v, want credential from %s", ev, name)
+		}
+	}
+	health := m.Health()
+	if len(health) != 2 || health[0].Name != "front" || health[1].Name != "back" {
+		t.Fatalf("Health() = %+v, want front and back", health)
+	}
+	for _, h := range health {
+		if !h.Running || h.Stats.Bits != 26 || h.LastEvent.IsZero() {
+			t.Errorf("Health() for %s = %+v, want running with one frame", h.Name, h)
+		}
+	}
+}
+
+func TestManagerRestart(t *testing.T) {
+	m, lines := newTestManager(t, "door")
+	failure := errors.New("line went away")
+	lines["door"].Fail(failure)
+	var le *wiegand.LineError
+	if ev := nextEvent(t, m); !errors.As(ev.Err, &le) || !errors.Is(ev.Err, failure) {
+		t.Fatalf("got event %+v, want LineError", ev)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for h := m.Health()[0]; h.Restarts == 0 || !h.Running; h = m.Health()[0] {
+		if time.Now().After(deadline) {
+			t.Fatalf("reader not restarted: %+v", h)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := lines["door"].SendFrame(wiegand.Format26, 2, 99); err != nil {
+		t.Fatalf("SendFrame() error = %v", err)
+	}
+	if ev := nextEvent(t, m); ev.Credential == nil || ev.Credential.Tag != 99 {
+		t.Errorf("got event %+v after restart, want credential", ev)
+	}
+}
+
+func TestManagerFormats(t *testing.T) {
+	corporate := wiegand.Format{Name: "35-bit", Bits: 35, Site: wiegand.Field{Start: 2, Length: 12}, Tag: wiegand.Field{Start: 14, Length: 20}}
+	lines := wiegandtest.Lines{"a": wiegandtest.NewLine(), "b": wiegandtest.NewLine()}
+	m, err := wiegand.NewManager(context.Background(), wiegand.ManagerConfig{
+		Readers: []wiegand.ReaderDef{
+			{Name: "a", D0Pin: "a/D0", D1Pin: "a/D1", Formats: []wiegand.Format{corporate}},
+			{Name: "b", D0Pin: "b/D0", D1Pin: "b/D1"},
+		},
+		Reader: wiegand.Config{Backend: lines},
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer m.Close()
+	var names []string
+	for _, f := range m.Formats() {
+		names = append(names, f.Name)
+	}
+	if want := []string{"26-bit", "34-bit", "35-bit", "37-bit"}; !slices.Equal(names, want) {
+		t.Errorf("Formats() = %v, want the built-in formats and reader a's own, once each", names)
+	}
+}
+
+func TestManagerConfigErrors(t *testing.T) {
+	lines := wiegandtest.Lines{"a": wiegandtest.NewLine()}
+	tests := []struct {
+		name string
+		defs []wiegand.ReaderDef
+	}{
+		{"no readers", nil},
+		{"no name", []wiegand.ReaderDef{{D0Pin: "a/D0", D1Pin: "a/D1"}}},
+		{"duplicate", []wiegand.ReaderDef{{Name: "a", D0Pin: "a/D0", D1Pin: "a/D1"}, {Name: "a", D0Pin: "a/D0", D1Pin: "a/D1"}}},
+		{"unknown line", []wiegand.ReaderDef{{Name: "b", D0Pin: "b/D0", D1Pin: "b/D1"}}},
+		{"unknown passback reader", []wiegand.ReaderDef{{Name: "a", D0Pin: "a/D0", D1Pin: "a/D1"}}},
+	}
+	for _, tt := range tests {
+		m, err := wiegand.NewManager(context.Background(), wiegand.ManagerConfig{
+			Readers:  tt.defs,
+			Reader:   wiegand.Config{Backend: lines, DuplicateWindow: time.Millisecond},
+			Passback: []wiegand.PassbackArea{{Name: "lobby", In: []string{"a"}, Out: []string{"exit"}}},
+		})
+		if err == nil {
+			m.Close()
+			t.Errorf("%s: NewManager() succeeded, want error", tt.name)
+		}
+	}
+
+	m, err := wiegand.NewManager(context.Background(), wiegand.ManagerConfig{
+		Readers:  []wiegand.ReaderDef{{Name: "a", D0Pin: "a/D0", D1Pin: "a/D1"}, {Name: "exit", D0Pin: "a/D0", D1Pin: "a/D1"}},
+		Reader:   wiegand.Config{Backend: lines},
+		Passback: []wiegand.PassbackArea{{Name: "lobby", In: []string{"a"}, Out: []string{"exit"}}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "DuplicateWindow") {
+		if err == nil {
+			m.Close()
+		}
+		t.Errorf("NewManager() with passback and no DuplicateWindow error = %v, want DuplicateWindow required", err)
+	}
+}
+
+func TestManagerPassback(t *testing.T) {
+	m, lines := newTestManagerConfig(t, wiegand.ManagerConfig{
+		// The window is wide enough for a repeated frame and its timeout
+		// even on a loaded machine.
+		Reader:   wiegand.Config{DuplicateWindow: 250 * time.Millisecond, Duplicates: wiegand.DuplicateFlag},
+		Passback: []wiegand.PassbackArea{{Name: "lobby", In: []string{"in"}, Out: []string{"out"}}},
+	}, "in", "out")
+	readFormat := func(reader string, f wiegand.Format, tag uint64) wiegand.Event {
+		t.Helper()
+		if err := lines[reader].SendFrame(f, 1, tag); err != nil {
+			t.Fatalf("SendFrame() error = %v", err)
+		}
+		return nextEvent(t, m)
+	}
+	read := func(reader string, tag uint64) wiegand.Event {
+		t.Helper()
+		return readFormat(reader, wiegand.Format26, tag)
+	}
+
+	if ev := read("in", 7); ev.Credential == nil {
+		t.Fatalf("first entry = %+v, want credential", ev)
+	}
+	// A card held against the reader repeats its frame; the repeat is
+	// flagged as a duplicate rather than denied as a second entry.
+	if err := lines["in"].SendFrame(wiegand.Format26, 1, 7); err != nil {
+		t.Fatalf("SendFrame() error = %v", err)
+	}
+	if ev := nextEvent(t, m); ev.Credential == nil || !ev.Credential.Duplicate {
+		t.Fatalf("repeated frame = %+v, want duplicate credential", ev)
+	}
+	time.Sleep(250 * time.Millisecond)
+	var pe *wiegand.PassbackError
+	if ev := read("in", 7); !errors.As(ev.Err, &pe) || pe.Area != "lobby" || pe.Credential.Tag != 7 || ev.Reader != "in" {
+		t.Fatalf("re-entry = %+v, want PassbackError", ev)
+	}
+	if ev := read("in", 8); ev.Credential == nil {
+		t.Errorf("entry of another card = %+v, want credential", ev)
+	}
+	if ev := readFormat("in", wiegand.Format34, 7); ev.Credential == nil {
+		t.Errorf("entry of a 34-bit card with the same numbers = %+v, want credential", ev)
+	}
+	if ev := read("out", 7); ev.Credential == nil {
+		t.Fatalf("exit = %+v, want credential", ev)
+	}
+	if ev := read("in", 7); ev.Credential == nil {
+		t.Errorf("entry after exit = %+v, want credential", ev)
+	}
+
+	time.Sleep(250 * time.Millisecond) // Read again after the DuplicateWindow
+	m.ResetPassback("26-bit", 1, 7)
+	if ev := read("in", 7); ev.Credential == nil {
+		t.Errorf("entry after ResetPassback() = %+v, want credential", ev)
+	}
+	if h := m.Health()[0]; h.LastError != nil {
+		t.Errorf("Health() LastError = %v, want passback denials not counted as reader errors", h.LastError)
+	}
+}
+
+func TestManagerFeedback(t *testing.T) {
+	shared, led := &recordingPin{}, &recordingPin{}
+	lines := wiegandtest.Lines{"front": wiegandtest.NewLine(), "back": wiegandtest.NewLine()}
+	m, err := wiegand.NewManager(context.Background(), wiegand.ManagerConfig{
+		Readers: []wiegand.ReaderDef{
+			{Name: "front", D0Pin: "front/D0", D1Pin: "front/D1", Feedback: wiegand.FeedbackConfig{LED: led}},
+			{Name: "back", D0Pin: "back/D0", D1Pin: "back/D1"},
+		},
+		// Outputs shared by every reader would conflict, so they are
+		// ignored.
+		Reader: wiegand.Config{Backend: lines, Feedback: wiegand.FeedbackConfig{LED: shared}},
+	})
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer m.Close()
+
+	if f := m.Feedback("back"); f != nil {
+		t.Errorf("Feedback(back) = %v, want nil without outputs", f)
+	}
+	if f := m.Feedback("side"); f != nil {
+		t.Errorf("Feedback(side) = %v, want nil for an unknown reader", f)
+	}
+	m.Feedback("front").Play(wiegand.Pattern{Steps: []wiegand.Step{{LED: true, Duration: 5 * time.Millisecond}}})
+	time.Sleep(50 * time.Millisecond)
+	if got, want := led.recorded(), []gpio.Level{gpio.Low, gpio.High, gpio.Low}; !slices.Equal(got, want) {
+		t.Errorf("front LED levels = %v, want %v", got, want)
+	}
+	if got := shared.recorded(); len(got) != 0 {
+		t.Errorf("shared LED levels = %v, want it unused", got)
+	}
+}
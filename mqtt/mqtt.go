@@ -0,0 +1,483 @@
+// Package mqtt publishes the events of Wiegand readers to an MQTT broker.
+// It contains a small MQTT 3.1.1 client supporting what a publisher needs:
+// QoS 0 and 1, retained status topics backed by a last will, keepalive and
+// reconnection.
+//
+// Each event is published as the JSON encoding of wiegand.Event, which for a
+// credential carries the reader name, format, site code, tag, raw bits and
+// time. A Publisher plugs into the event stream of a Reader or Manager:
+//
+//	pub, err := mqtt.New(mqtt.Config{Broker: "localhost:1883"})
+//	...
+//	for ev := range manager.Read() {
+//		pub.Publish(ev)
+//	}
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+// DefaultTopic is the default topic events are published to. {reader} is
+// replaced by the name of the reader and {type} by the event type, such as
+// "credential" or "error". The characters '/', '+' and '#', which have a
+// meaning in topics, are replaced by '_' in reader names.
+const DefaultTopic = "wiegand/{reader}/{type}"
+
+// DefaultStatusTopic is the default topic holding the retained "online" or
+// "offline" status of the Publisher.
+const DefaultStatusTopic = "wiegand/status"
+
+// DefaultReaderStatusTopic is the default topic holding the retained status
+// of each reader in Config.Readers. {reader} is replaced as in DefaultTopic.
+const DefaultReaderStatusTopic = "wiegand/{reader}/status"
+
+// Status payloads published to the status topics.
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+// Defaults for Config.
+const (
+	DefaultClientID   = "wiegand"
+	DefaultKeepAlive  = 30 * time.Second
+	DefaultQueueSize  = 256
+	DefaultRetryDelay = 5 * time.Second
+)
+
+// Config holds configuration for creating a Publisher.
+type Config struct {
+	Broker   string // Address of the broker, "host:port"
+	ClientID string // Client identifier (default DefaultClientID)
+	Username string // Optional
+	Password string // Optional
+	// Topic is the topic template for events (default DefaultTopic).
+	Topic string
+	// StatusTopic receives a retained StatusOnline message on connecting,
+	// and StatusOffline on Close or, as the last will, when the connection
+	// is lost (default DefaultStatusTopic).
+	StatusTopic string
+	// Readers names the readers whose status is kept, retained, on
+	// ReaderStatusTopic: StatusOnline on connecting, StatusOffline from a
+	// published *wiegand.LineError of the reader until its next event, and
+	// StatusOffline on Close. A lost connection is only reported on
+	// StatusTopic, by its last will. Optional.
+	Readers []string
+	// ReaderStatusTopic is the topic template for the status of each
+	// reader (default DefaultReaderStatusTopic).
+	ReaderStatusTopic string
+	QoS               byte          // 0 (at most once, default) or 1 (at least once)
+	KeepAlive         time.Duration // Keepalive interval (default DefaultKeepAlive)
+	// QueueSize is the number of events buffered while the broker is slow
+	// or unreachable (default DefaultQueueSize). Further events are dropped
+	// and counted by Dropped.
+	QueueSize  int
+	RetryDelay time.Duration // Time between connection attempts (default DefaultRetryDelay)
+	// Dial connects to the broker. Optional; a plain TCP connection is
+	// used by default. Set it to connect over TLS.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	// ErrorHandler is called with connection errors. Optional.
+	ErrorHandler func(error)
+}
+
+// closeTimeout bounds how long Close waits for the broker to acknowledge the
+// queued events and the offline status.
+const closeTimeout = 2 * time.Second
+
+// errClosing aborts waiting for a PUBACK when Close is called.
+var errClosing = errors.New("publisher closing")
+
+// Publisher publishes events to an MQTT broker. It connects in the
+// background and reconnects whenever the connection is lost. It is safe for
+// concurrent use.
+type Publisher struct {
+	cfg       Config
+	queue     chan message
+	done      chan struct{} // Closed by Close
+	stopped   chan struct{} // Closed when run exits
+	closeOnce sync.Once
+	dropped   atomic.Uint64
+	nextID    uint16 // Last packet identifier used, accessed only by run
+
+	mu     sync.Mutex
+	failed map[string]bool // Readers in cfg.Readers, mapped to whether their data line failed
+}
+
+// New creates a Publisher and starts connecting to the broker.
+func New(cfg Config) (*Publisher, error) {
+	if cfg.Broker == "" {
+		return nil, errors.New("broker address must be specified")
+	}
+	if cfg.QoS > 1 {
+		return nil, fmt.Errorf("unsupported QoS %d", cfg.QoS)
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = DefaultClientID
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = DefaultTopic
+	}
+	if cfg.StatusTopic == "" {
+		cfg.StatusTopic = DefaultStatusTopic
+	}
+	if cfg.ReaderStatusTopic == "" {
+		cfg.ReaderStatusTopic = DefaultReaderStatusTopic
+	}
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = DefaultKeepAlive
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+	if cfg.Dial == nil {
+		var d net.Dialer
+		cfg.Dial = d.DialContext
+	}
+	p := &Publisher{
+		cfg:     cfg,
+		queue:   make(chan message, cfg.QueueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		failed:  make(map[string]bool, len(cfg.Readers)),
+	}
+	for _, name := range cfg.Readers {
+		p.failed[name] = false
+	}
+	go p.run()
+	return p, nil
+}
+
+// Publish queues an event for publishing. It never blocks: if the queue is
+// full the event is dropped.
+func (p *Publisher) Publish(ev wiegand.Event) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		p.report(err)
+		return
+	}
+	var le *wiegand.LineError
+	if failed := errors.As(ev.Err, &le); p.setFailed(ev.Reader, failed) {
+		status := StatusOnline
+		if failed {
+			status = StatusOffline
+		}
+		p.enqueue(p.readerStatus(ev.Reader, status))
+	}
+	topic := strings.NewReplacer("{reader}", levelEscaper.Replace(ev.Reader), "{type}", ev.Type()).Replace(p.cfg.Topic)
+	p.enqueue(message{topic: topic, payload: payload, qos: p.cfg.QoS})
+}
+
+// enqueue queues m, or drops it if the queue is full.
+func (p *Publisher) enqueue(m message) {
+	select {
+	case p.queue <- m:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// setFailed records whether the data line of reader has failed, reporting
+// whether that changed its status. Readers not in cfg.Readers have none.
+func (p *Publisher) setFailed(reader string, failed bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	was, ok := p.failed[reader]
+	if !ok || was == failed {
+		return false
+	}
+	p.failed[reader] = failed
+	return true
+}
+
+// levelEscaper makes a reader name a single topic level without wildcards.
+var levelEscaper = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// Dropped returns the number of events dropped because the queue was full.
+func (p *Publisher) Dropped() uint64 {
+	return p.dropped.Load()
+}
+
+// Close publishes the events already queued if the broker is connected,
+// sets the status topic to StatusOffline and disconnects. It gives up on an
+// unresponsive broker after a couple of seconds.
+func (p *Publisher) Close() error {
+	p.closeOnce.Do(func() { close(p.done) })
+	<-p.stopped
+	return nil
+}
+
+func (p *Publisher) report(err error) {
+	if p.cfg.ErrorHandler != nil {
+		p.cfg.ErrorHandler(err)
+	}
+}
+
+// status returns the retained message setting the status topic.
+func (p *Publisher) status(s string) message {
+	return message{topic: p.cfg.StatusTopic, payload: []byte(s), qos: p.cfg.QoS, retain: true}
+}
+
+// readerStatus returns the retained message setting the status topic of
+// reader.
+func (p *Publisher) readerStatus(reader, s string) message {
+	topic := strings.ReplaceAll(p.cfg.ReaderStatusTopic, "{reader}", levelEscaper.Replace(reader))
+	return message{topic: topic, payload: []byte(s), qos: p.cfg.QoS, retain: true}
+}
+
+// online returns the messages setting the status topics on connecting: the
+// Publisher is online, as is each reader whose data line has not failed.
+func (p *Publisher) online() []message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ms := []message{p.status(StatusOnline)}
+	for _, name := range p.cfg.Readers {
+		s := StatusOnline
+		if p.failed[name] {
+			s = StatusOffline
+		}
+		ms = append(ms, p.readerStatus(name, s))
+	}
+	return ms
+}
+
+// offline returns the messages setting every status topic offline on Close.
+func (p *Publisher) offline() []message {
+	var ms []message
+	for _, name := range p.cfg.Readers {
+		ms = append(ms, p.readerStatus(name, StatusOffline))
+	}
+	return append(ms, p.status(StatusOffline))
+}
+
+// run maintains the connection to the broker until Close.
+func (p *Publisher) run() {
+	defer close(p.stopped)
+	var pending *message // Unacknowledged message to send again
+	for {
+		conn, r, err := p.connect()
+		if err == nil {
+			pending, err = p.serve(conn, r, pending)
+			conn.Close()
+			if err == nil {
+				return
+			}
+		}
+		p.report(err)
+		select {
+		case <-p.done:
+			return
+		case <-time.After(p.cfg.RetryDelay):
+		}
+	}
+}
+
+// connect dials the broker and completes the MQTT handshake, returning the
+// connection and a reader for the packets which follow the CONNACK.
+func (p *Publisher) connect() (net.Conn, *bufio.Reader, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.KeepAlive)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	conn, err := p.cfg.Dial(ctx, "tcp", p.cfg.Broker)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Close interrupts the handshake too.
+	stopHandshake := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stopHandshake()
+	will := p.status(StatusOffline)
+	keepAlive := uint16(min(p.cfg.KeepAlive/time.Second, 65535))
+	conn.SetDeadline(time.Now().Add(p.cfg.KeepAlive))
+	if _, err := conn.Write(connectPacket(p.cfg.ClientID, p.cfg.Username, p.cfg.Password, keepAlive, &will)); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	r := bufio.NewReader(conn)
+	ack, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("reading CONNACK: %w", err)
+	}
+	if ack.kind != typeConnack || len(ack.body) != 2 {
+		conn.Close()
+		return nil, nil, fmt.Errorf("unexpected packet type %d in place of CONNACK", ack.kind)
+	}
+	if code := ack.body[1]; code != 0 {
+		conn.Close()
+		return nil, nil, &ConnectError{Code: code}
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, r, nil
+}
+
+// serve publishes queued messages on an established connection until it
+// fails, returning any message left unacknowledged, or until Close, when it
+// returns a nil error.
+func (p *Publisher) serve(conn net.Conn, r *bufio.Reader, pending *message) (*message, error) {
+	acks := make(chan packet)
+	readErr := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			pk, err := readPacket(r)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case acks <- pk:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var pingSent time.Time // When an unanswered PINGREQ was sent
+	// awaitAck waits for the PUBACK of the message with identifier id until
+	// abort is closed.
+	awaitAck := func(id uint16, abort <-chan struct{}) error {
+		timeout := time.NewTimer(p.cfg.KeepAlive)
+		defer timeout.Stop()
+		for {
+			select {
+			case pk := <-acks:
+				switch {
+				case pk.kind == typePingresp:
+					pingSent = time.Time{}
+				case pk.kind == typePuback && len(pk.body) == 2 && uint16(pk.body[0])<<8|uint16(pk.body[1]) == id:
+					return nil
+				}
+			case err := <-readErr:
+				return err
+			case <-timeout.C:
+				return errors.New("timed out waiting for PUBACK")
+			case <-abort:
+				return errClosing
+			}
+		}
+	}
+	// send writes a message and, for QoS 1, waits for its acknowledgement
+	// until abort is closed. On errClosing the message has been written
+	// with identifier p.nextID.
+	send := func(m message, abort <-chan struct{}) error {
+		if m.qos > 0 {
+			if p.nextID++; p.nextID == 0 {
+				p.nextID = 1
+			}
+			m.id = p.nextID
+		}
+		if _, err := conn.Write(publishPacket(m)); err != nil {
+			return err
+		}
+		if m.qos == 0 {
+			return nil
+		}
+		return awaitAck(m.id, abort)
+	}
+	// shutdown waits for the PUBACK of the message sent with identifier
+	// unacked, if not zero, publishes retry, if set, and the queued
+	// messages, then the offline statuses, giving the broker closeTimeout
+	// to acknowledge them.
+	shutdown := func(unacked uint16, retry *message) (*message, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		defer cancel()
+		conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+		if unacked != 0 && awaitAck(unacked, ctx.Done()) != nil {
+			return nil, nil
+		}
+		if retry != nil && send(*retry, ctx.Done()) != nil {
+			return nil, nil
+		}
+		for {
+			select {
+			case m := <-p.queue:
+				if send(m, ctx.Done()) != nil {
+					return nil, nil
+				}
+			default:
+				for _, m := range p.offline() {
+					if send(m, ctx.Done()) != nil {
+						return nil, nil
+					}
+				}
+				conn.Write(encode(typeDisconnect, 0, nil))
+				return nil, nil
+			}
+		}
+	}
+
+	for _, m := range p.online() {
+		if err := send(m, p.done); err != nil {
+			if err == errClosing {
+				return shutdown(p.nextID, pending)
+			}
+			return pending, err
+		}
+	}
+	if pending != nil {
+		m := *pending
+		m.dup = true
+		if err := send(m, p.done); err != nil {
+			if err == errClosing {
+				return shutdown(p.nextID, nil)
+			}
+			return pending, err
+		}
+	}
+
+	ping := time.NewTicker(p.cfg.KeepAlive / 2)
+	defer ping.Stop()
+	for {
+		select {
+		case m := <-p.queue:
+			if err := send(m, p.done); err != nil {
+				if err == errClosing {
+					return shutdown(p.nextID, nil)
+				}
+				if m.qos > 0 {
+					return &m, err
+				}
+				return nil, err
+			}
+		case <-ping.C:
+			if !pingSent.IsZero() && time.Since(pingSent) > p.cfg.KeepAlive {
+				return nil, errors.New("no PINGRESP from broker")
+			}
+			if _, err := conn.Write(encode(typePingreq, 0, nil)); err != nil {
+				return nil, err
+			}
+			if pingSent.IsZero() {
+				pingSent = time.Now()
+			}
+		case pk := <-acks:
+			if pk.kind == typePingresp {
+				pingSent = time.Time{}
+			}
+		case err := <-readErr:
+			return nil, err
+		case <-p.done:
+			return shutdown(0, nil)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+	"github.com/asjoyner/wiegand-go/wiegandtest"
+)
+
+// connectInfo is the content of a CONNECT received by testBroker.
+type connectInfo struct {
+	clientID    string
+	willTopic   string
+	willPayload string
+	willRetain  bool
+}
+
+// testBroker is a minimal stand-in for an MQTT broker, accepting one
+// connection at a time.
+type testBroker struct {
+	ln       net.Listener
+	connects chan connectInfo
+	messages chan message
+	// drop, if set, closes the connection instead of acknowledging the
+	// next PUBLISH matching it.
+	drop        func(message) bool
+	disconnects chan struct{}
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	b := &testBroker{
+		ln:          ln,
+		connects:    make(chan connectInfo, 10),
+		messages:    make(chan message, 100),
+		disconnects: make(chan struct{}, 10),
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *testBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	pk, err := readPacket(r)
+	if err != nil || pk.kind != typeConnect {
+		return
+	}
+	// Protocol name, level, flags and keepalive precede the client ID.
+	_, rest, _ := readString(pk.body)
+	flags := rest[1]
+	var info connectInfo
+	info.clientID, rest, _ = readString(rest[4:])
+	if flags&flagWill != 0 {
+		info.willTopic, rest, _ = readString(rest)
+		info.willPayload, _, _ = readString(rest)
+		info.willRetain = flags&flagWillRetain != 0
+	}
+	b.connects <- info
+	conn.Write(encode(typeConnack, 0, []byte{0, 0}))
+
+	for {
+		pk, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch pk.kind {
+		case typePublish:
+			m, err := parsePublish(pk)
+			if err != nil {
+				return
+			}
+			if b.drop != nil && b.drop(m) {
+				b.drop = nil
+				return
+			}
+			b.messages <- m
+			if m.qos > 0 {
+				conn.Write(encode(typePuback, 0, binary.BigEndian.AppendUint16(nil, m.id)))
+			}
+		case typePingreq:
+			conn.Write(encode(typePingresp, 0, nil))
+		case typeDisconnect:
+			b.disconnects <- struct{}{}
+			return
+		}
+	}
+}
+
+// readString reads a length-prefixed string from the front of b.
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("truncated string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("truncated string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// parsePublish decodes the message of a PUBLISH packet.
+func parsePublish(p packet) (message, error) {
+	m := message{qos: p.flags >> 1 & 3, retain: p.flags&1 != 0, dup: p.flags&8 != 0}
+	topic, rest, err := readString(p.body)
+	if err != nil {
+		return message{}, err
+	}
+	m.topic = topic
+	if m.qos > 0 {
+		if len(rest) < 2 {
+			return message{}, errors.New("truncated packet identifier")
+		}
+		m.id, rest = binary.BigEndian.Uint16(rest), rest[2:]
+	}
+	m.payload = rest
+	return m, nil
+}
+
+func (b *testBroker) message(t *testing.T) message {
+	t.Helper()
+	select {
+	case m := <-b.messages:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a message")
+	}
+	return message{}
+}
+
+func TestPublisher(t *testing.T) {
+	b := newTestBroker(t)
+	pub, err := New(Config{Broker: b.ln.Addr().String(), ClientID: "door-controller", QoS: 1})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	line := wiegandtest.NewLine()
+	line.Interval = time.Millisecond
+	r, err := wiegand.New(context.Background(), wiegand.Config{
+		Name:    "door",
+		D0Pin:   "D0",
+		D1Pin:   "D1",
+		Backend: line,
+		Timeout: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("wiegand.New() error = %v", err)
+	}
+	defer r.Close()
+	go func() {
+		for ev := range r.Read() {
+			pub.Publish(ev)
+		}
+	}()
+
+	info := <-b.connects
+	if info.clientID != "door-controller" || info.willTopic != DefaultStatusTopic || info.willPayload != StatusOffline || !info.willRetain {
+		t.Errorf("CONNECT = %+v, want retained offline will on %s", info, DefaultStatusTopic)
+	}
+	if m := b.message(t); m.topic != DefaultStatusTopic || string(m.payload) != StatusOnline || !m.retain {
+		t.Errorf("first message = %+v, want retained online status", m)
+	}
+
+	if err := line.SendFrame(wiegand.Format26, 15, 54321); err != nil {
+		t.Fatalf("SendFrame() error = %v", err)
+	}
+	m := b.message(t)
+	var got struct {
+		Reader, Format, Bits string
+		Site, Tag            uint64
+		Time                 time.Time
+	}
+	if err := json.Unmarshal(m.payload, &got); err != nil {
+		t.Fatalf("payload %s: %v", m.payload, err)
+	}
+	if m.topic != "wiegand/door/credential" || m.qos != 1 || got.Reader != "door" || got.Format != "26-bit" ||
+		got.Site != 15 || got.Tag != 54321 || len(got.Bits) != 26 || got.Time.IsZero() {
+		t.Errorf("got %s on %s (QoS %d), want 26-bit 15:54321 from door", m.payload, m.topic, m.qos)
+	}
+
+	pub.Close()
+	if m := b.message(t); m.topic != DefaultStatusTopic || string(m.payload) != StatusOffline || !m.retain {
+		t.Errorf("message on Close = %+v, want retained offline status", m)
+	}
+	select {
+	case <-b.disconnects:
+	case <-time.After(time.Second):
+		t.Error("no DISCONNECT on Close")
+	}
+}
+
+func TestPublisherTopicEscaping(t *testing.T) {
+	b := newTestBroker(t)
+	pub, err := New(Config{Broker: b.ln.Addr().String()})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pub.Close()
+	b.message(t) // Online status
+	pub.Publish(wiegand.Event{Reader: "floor/1+#", Time: time.Now(), Credential: &wiegand.Credential{Format: "26-bit", Tag: 7}})
+	if m := b.message(t); m.topic != "wiegand/floor_1__/credential" {
+		t.Errorf("topic = %q, want wiegand/floor_1__/credential", m.topic)
+	}
+}
+
+func TestPublisherReaderStatus(t *testing.T) {
+	b := newTestBroker(t)
+	pub, err := New(Config{Broker: b.ln.Addr().String(), Readers: []string{"door", "gate"}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	expect := func(what, topic, payload string) {
+		t.Helper()
+		if m := b.message(t); m.topic != topic || string(m.payload) != payload || !m.retain {
+			t.Errorf("%s: got %s on %s (retain %v), want retained %s on %s", what, m.payload, m.topic, m.retain, payload, topic)
+		}
+	}
+	expect("connecting", DefaultStatusTopic, StatusOnline)
+	expect("connecting", "wiegand/door/status", StatusOnline)
+	expect("connecting", "wiegand/gate/status", StatusOnline)
+
+	pub.Publish(wiegand.Event{Reader: "door", Time: time.Now(), Err: &wiegand.LineError{Reader: "door", Err: errors.New("gone")}})
+	expect("line failure", "wiegand/door/status", StatusOffline)
+	if m := b.message(t); m.topic != "wiegand/door/error" {
+		t.Errorf("got %+v, want the line error", m)
+	}
+	pub.Publish(wiegand.Event{Reader: "door", Time: time.Now(), Credential: &wiegand.Credential{Format: "26-bit", Tag: 7}})
+	expect("event after restart", "wiegand/door/status", StatusOnline)
+	if m := b.message(t); m.topic != "wiegand/door/credential" {
+		t.Errorf("got %+v, want the credential", m)
+	}
+
+	pub.Close()
+	expect("Close", "wiegand/door/status", StatusOffline)
+	expect("Close", "wiegand/gate/status", StatusOffline)
+	expect("Close", DefaultStatusTopic, StatusOffline)
+}
+
+func TestPublisherReconnect(t *testing.T) {
+	b := newTestBroker(t)
+	b.drop = func(m message) bool { return m.topic != DefaultStatusTopic }
+	errs := make(chan error, 10)
+	pub, err := New(Config{
+		Broker:       b.ln.Addr().String(),
+		QoS:          1,
+		RetryDelay:   10 * time.Millisecond,
+		ErrorHandler: func(err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pub.Close()
+
+	pub.Publish(wiegand.Event{Reader: "gate", Time: time.Now(), Credential: &wiegand.Credential{Format: "26-bit", Tag: 7}})
+	b.message(t) // Online status
+	// The broker drops the connection instead of acknowledging the event,
+	// so it is sent again after reconnecting.
+	if m := b.message(t); m.topic != DefaultStatusTopic {
+		t.Fatalf("got %+v, want online status after reconnecting", m)
+	}
+	if m := b.message(t); m.topic != "wiegand/gate/credential" || !m.dup {
+		t.Errorf("got %+v, want the credential again with DUP set", m)
+	}
+	if len(errs) == 0 {
+		t.Error("connection loss not reported")
+	}
+}
+
+func TestPublisherCloseUnresponsiveBroker(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		connack bool // Accept the connection, but never acknowledge a PUBLISH
+	}{
+		{"no CONNACK", false},
+		{"no PUBACK", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Listen() error = %v", err)
+			}
+			defer ln.Close()
+			connected := make(chan struct{})
+			go func() {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				readPacket(r)
+				if tt.connack {
+					conn.Write(encode(typeConnack, 0, []byte{0, 0}))
+					readPacket(r) // Online status
+				}
+				close(connected)
+				for {
+					if _, err := readPacket(r); err != nil {
+						return
+					}
+				}
+			}()
+			pub, err := New(Config{Broker: ln.Addr().String(), QoS: 1})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			<-connected
+			start := time.Now()
+			pub.Close()
+			if d := time.Since(start); d > closeTimeout+time.Second {
+				t.Errorf("Close() took %v with a %v keepalive", d, DefaultKeepAlive)
+			}
+		})
+	}
+}
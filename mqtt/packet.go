@@ -0,0 +1,165 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MQTT 3.1.1 control packet types, in the high nibble of the first byte.
+const (
+	typeConnect    = 1
+	typeConnack    = 2
+	typePublish    = 3
+	typePuback     = 4
+	typePingreq    = 12
+	typePingresp   = 13
+	typeDisconnect = 14
+)
+
+// CONNECT flags.
+const (
+	flagCleanSession = 0x02
+	flagWill         = 0x04
+	flagWillRetain   = 0x20
+	flagPassword     = 0x40
+	flagUsername     = 0x80
+)
+
+// packet is a decoded control packet.
+type packet struct {
+	kind  byte // Packet type
+	flags byte // Low nibble of the first byte
+	body  []byte
+}
+
+// message is an application message carried by PUBLISH.
+type message struct {
+	topic   string
+	payload []byte
+	qos     byte
+	retain  bool
+	dup     bool
+	id      uint16 // Packet identifier, for QoS 1
+}
+
+// appendString appends a length-prefixed UTF-8 string.
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// encode returns the packet with its fixed header.
+func encode(kind, flags byte, body []byte) []byte {
+	b := []byte{kind<<4 | flags}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(b, body...)
+}
+
+// connectPacket encodes a CONNECT with a clean session.
+func connectPacket(clientID, username, password string, keepAlive uint16, will *message) []byte {
+	flags := byte(flagCleanSession)
+	if will != nil {
+		flags |= flagWill | will.qos<<3
+		if will.retain {
+			flags |= flagWillRetain
+		}
+	}
+	if username != "" {
+		flags |= flagUsername
+	}
+	if password != "" {
+		flags |= flagPassword
+	}
+	b := appendString(nil, "MQTT")
+	b = append(b, 4, flags) // Protocol level 4 is MQTT 3.1.1
+	b = binary.BigEndian.AppendUint16(b, keepAlive)
+	b = appendString(b, clientID)
+	if will != nil {
+		b = appendString(b, will.topic)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(will.payload)))
+		b = append(b, will.payload...)
+	}
+	if username != "" {
+		b = appendString(b, username)
+	}
+	if password != "" {
+		b = appendString(b, password)
+	}
+	return encode(typeConnect, 0, b)
+}
+
+// publishPacket encodes a PUBLISH.
+func publishPacket(m message) []byte {
+	flags := m.qos << 1
+	if m.retain {
+		flags |= 1
+	}
+	if m.dup {
+		flags |= 8
+	}
+	b := appendString(nil, m.topic)
+	if m.qos > 0 {
+		b = binary.BigEndian.AppendUint16(b, m.id)
+	}
+	return encode(typePublish, flags, append(b, m.payload...))
+}
+
+// readPacket reads one control packet.
+func readPacket(r *bufio.Reader) (packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	var n, shift int
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		n |= int(digit&0x7f) << shift
+		if digit&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return packet{}, errors.New("malformed remaining length")
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: first >> 4, flags: first & 0x0f, body: body}, nil
+}
+
+// ConnectError reports a connection refused by the broker.
+type ConnectError struct {
+	Code byte // CONNACK return code
+}
+
+func (e *ConnectError) Error() string {
+	reasons := map[byte]string{
+		1: "unacceptable protocol version",
+		2: "identifier rejected",
+		3: "server unavailable",
+		4: "bad user name or password",
+		5: "not authorized",
+	}
+	if reason, ok := reasons[e.Code]; ok {
+		return "connection refused: " + reason
+	}
+	return fmt.Sprintf("connection refused: code %d", e.Code)
+}
@@ -0,0 +1,80 @@
+package wiegand
+
+import (
+	"fmt"
+	"slices"
+)
+
+// PassbackArea is an area whose entry and exit readers enforce
+// anti-passback: once a card has entered, it is denied entry again until
+// it has been read leaving, so that it cannot be passed back to let a
+// second person in.
+type PassbackArea struct {
+	Name string   // Identifies the area in errors
+	In   []string // Names of the readers entering the area
+	Out  []string // Names of the readers leaving the area
+}
+
+// passbackKey identifies a card for anti-passback. Cards of different
+// formats may carry the same site code and tag.
+type passbackKey struct {
+	format    string
+	site, tag uint64
+}
+
+// passback tracks the cards inside each PassbackArea of a Manager.
+type passback struct {
+	areas  []PassbackArea
+	inside []map[passbackKey]bool // Cards inside each area, by index in areas
+}
+
+// newPassback checks that the areas refer only to the named readers.
+func newPassback(areas []PassbackArea, readers map[string]bool) (*passback, error) {
+	p := &passback{areas: areas}
+	for _, a := range areas {
+		if len(a.In) == 0 || len(a.Out) == 0 {
+			return nil, fmt.Errorf("passback area %q needs entry and exit readers", a.Name)
+		}
+		for _, name := range append(slices.Clone(a.In), a.Out...) {
+			if !readers[name] {
+				return nil, fmt.Errorf("passback area %q: unknown reader %q", a.Name, name)
+			}
+		}
+		for _, name := range a.In {
+			if slices.Contains(a.Out, name) {
+				return nil, fmt.Errorf("passback area %q: reader %q both enters and leaves", a.Name, name)
+			}
+		}
+		p.inside = append(p.inside, make(map[passbackKey]bool))
+	}
+	return p, nil
+}
+
+// check records c passing through its reader, or returns a *PassbackError
+// if c is entering an area it is already inside. A denied credential is
+// recorded in no area. The caller's access decision is not known yet, so
+// a card is recorded entering even if it is then refused.
+func (p *passback) check(c Credential) error {
+	k := passbackKey{c.Format, c.Site, c.Tag}
+	for i, a := range p.areas {
+		if slices.Contains(a.In, c.Reader) && p.inside[i][k] {
+			return &PassbackError{Reader: c.Reader, Area: a.Name, Credential: c}
+		}
+	}
+	for i, a := range p.areas {
+		switch {
+		case slices.Contains(a.In, c.Reader):
+			p.inside[i][k] = true
+		case slices.Contains(a.Out, c.Reader):
+			delete(p.inside[i], k)
+		}
+	}
+	return nil
+}
+
+// reset forgets that a card is inside any area.
+func (p *passback) reset(format string, site, tag uint64) {
+	for _, in := range p.inside {
+		delete(in, passbackKey{format, site, tag})
+	}
+}
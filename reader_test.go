@@ -0,0 +1,600 @@
+package wiegand_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+	"github.com/asjoyner/wiegand-go/wiegandtest"
+)
+
+// simReader is a Reader attached to a simulated line, collecting its output.
+type simReader struct {
+	*wiegand.Reader
+	line  *wiegandtest.Line
+	creds chan wiegand.Credential
+	errs  chan error
+}
+
+func newSimReader(t *testing.T, cfg wiegand.Config) *simReader {
+	t.Helper()
+	s := &simReader{
+		line:  wiegandtest.NewLine(),
+		creds: make(chan wiegand.Credential, 10),
+		errs:  make(chan error, 10),
+	}
+	s.line.Interval = time.Millisecond
+	cfg.D0Pin, cfg.D1Pin = "D0", "D1"
+	cfg.Backend = s.line
+	cfg.CredentialCallback = func(c wiegand.Credential) { s.creds <- c }
+	cfg.ErrorHandler = func(err error) { s.errs <- err }
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 20 * time.Millisecond
+	}
+	r, err := wiegand.New(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	s.Reader = r
+	return s
+}
+
+func (s *simReader) credential(t *testing.T) wiegand.Credential {
+	t.Helper()
+	select {
+	case c := <-s.creds:
+		return c
+	case err := <-s.errs:
+		t.Fatalf("got error %v, want credential", err)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for credential")
+	}
+	return wiegand.Credential{}
+}
+
+func (s *simReader) error(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-s.errs:
+		return err
+	case c := <-s.creds:
+		t.Fatalf("got credential %v, want error", c)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error")
+	}
+	return nil
+}
+
+func TestReaderFrames(t *testing.T) {
+	tests := []struct {
+		format wiegand.Format
+		site   uint64
+		tag    uint64
+	}{
+		{wiegand.Format26, 15, 54321},
+		{wiegand.Format34, 65535, 1},
+		{wiegand.Format37, 300000, 4242},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format.Name, func(t *testing.T) {
+			s := newSimReader(t, wiegand.Config{Name: "sim"})
+			if err := s.line.SendFrame(tt.format, tt.site, tt.tag); err != nil {
+				t.Fatalf("SendFrame() error = %v", err)
+			}
+			c := s.credential(t)
+			if c.Reader != "sim" || c.Format != tt.format.Name || c.Site != tt.site || c.Tag != tt.tag {
+				t.Errorf("got %+v, want sim %s %d:%d", c, tt.format.Name, tt.site, tt.tag)
+			}
+			want, _ := tt.format.Encode(tt.site, tt.tag)
+			if string(c.Bits) != string(want) {
+				t.Errorf("got bits %v, want %v", c.Bits, want)
+			}
+		})
+	}
+}
+
+func TestReaderConsecutiveFrames(t *testing.T) {
+	s := newSimReader(t, wiegand.Config{})
+	for tag := uint64(1); tag <= 3; tag++ {
+		if err := s.line.SendFrame(wiegand.Format26, 1, tag); err != nil {
+			t.Fatalf("SendFrame() error = %v", err)
+		}
+		time.Sleep(40 * time.Millisecond)
+	}
+	for tag := uint64(1); tag <= 3; tag++ {
+		if c := s.credential(t); c.Tag != tag {
+			t.Errorf("got tag %d, want %d", c.Tag, tag)
+		}
+	}
+}
+
+func TestReaderCustomFormat(t *testing.T) {
+	f := wiegand.Format{
+		Name: "35-bit test",
+		Bits: 35,
+		Site: wiegand.Field{Start: 2, Length: 12},
+		Tag:  wiegand.Field{Start: 14, Length: 20},
+		Parity: []wiegand.ParityCheck{
+			{Field: wiegand.Field{Start: 1, Length: 17}, Bit: 1, Even: true},
+			{Field: wiegand.Field{Start: 17, Length: 18}, Bit: 34, Even: false},
+		},
+	}
+	s := newSimReader(t, wiegand.Config{Formats: []wiegand.Format{f}})
+	if err := s.line.SendFrame(f, 4000, 1000000); err != nil {
+		t.Fatalf("SendFrame() error = %v", err)
+	}
+	if c := s.credential(t); c.Format != f.Name || c.Site != 4000 || c.Tag != 1000000 {
+		t.Errorf("got %v, want %s 4000:1000000", c, f.Name)
+	}
+}
+
+func TestReaderFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults []wiegandtest.Fault
+		want   int
+	}{
+		{"missing bit", []wiegandtest.Fault{wiegandtest.DropBit(5)}, 25},
+		{"extra bit", []wiegandtest.Fault{wiegandtest.ExtraBit(20, 1)}, 27},
+		{"noise", []wiegandtest.Fault{wiegandtest.Noise(3, 0)}, 27},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSimReader(t, wiegand.Config{})
+			bits, _ := wiegand.Format26.Encode(15, 54321)
+			if err := s.line.SendWith(bits, tt.faults...); err != nil {
+				t.Fatalf("SendWith() error = %v", err)
+			}
+			var ule *wiegand.UnknownLengthError
+			if err := s.error(t); !errors.As(err, &ule) || len(ule.Bits) != tt.want {
+				t.Errorf("got error %v, want unknown %d-bit value", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReaderParityError(t *testing.T) {
+	s := newSimReader(t, wiegand.Config{Name: "sim"})
+	bits, _ := wiegand.Format34.Encode(100, 200)
+	bits[30] ^= 1
+	if err := s.line.Send(bits); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	var pe *wiegand.ParityError
+	if err := s.error(t); !errors.As(err, &pe) {
+		t.Fatalf("got error %v, want *ParityError", err)
+	}
+	if pe.Reader != "sim" || pe.Format != "34-bit" || !slices.Equal(pe.Failed, []int{1}) {
+		t.Errorf("got %+v, want sim 34-bit with trailing parity failed", pe)
+	}
+}
+
+func TestReaderErrorCallback(t *testing.T) {
+	msgs := make(chan string, 1)
+	line := wiegandtest.NewLine()
+	r, err := wiegand.New(context.Background(), wiegand.Config{
+		D0Pin:         "D0",
+		D1Pin:         "D1",
+		Backend:       line,
+		Callback:      func(site, tag string) {},
+		ErrorCallback: func(msg string) { msgs <- msg },
+		Timeout:       20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer r.Close()
+	line.Interval = time.Millisecond
+	line.Send([]byte{1, 0, 1})
+	select {
+	case msg := <-msgs:
+		if msg != "Received unknown 3-bit value" {
+			t.Errorf("got %q, want unknown 3-bit value", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error")
+	}
+}
+
+func TestReaderOrdersBitsByEdgeTime(t *testing.T) {
+	s := newSimReader(t, wiegand.Config{})
+	// D0 edges reach the Reader three bit periods late, so they arrive
+	// interleaved out of order with D1 edges sent after them.
+	s.line.Interval = 200 * time.Microsecond
+	s.line.Latency[0] = 600 * time.Microsecond
+	for _, tag := range []uint64{0x5555, 0xAAAA, 0x0F0F} {
+		if err := s.line.SendFrame(wiegand.Format26, 0x5A, tag); err != nil {
+			t.Fatalf("SendFrame() error = %v", err)
+		}
+		if c := s.credential(t); c.Site != 0x5A || c.Tag != tag {
+			t.Errorf("got %v, want 90:%d", c, tag)
+		}
+	}
+}
+
+func TestReaderOverflowDiscard(t *testing.T) {
+	s := newSimReader(t, wiegand.Config{})
+	bits := make([]byte, 45)
+	if err := s.line.Send(bits); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	var oe *wiegand.OverflowError
+	if err := s.error(t); !errors.As(err, &oe) || oe.MaxBits != 37 || len(oe.Bits) != 38 {
+		t.Fatalf("got error %v, want overflow of 37 bits", err)
+	}
+	// The rest of the runaway frame is discarded, then reading resumes
+	// after an idle gap.
+	time.Sleep(40 * time.Millisecond)
+	if err := s.line.SendFrame(wiegand.Format26, 1, 2); err != nil {
+		t.Fatalf("SendFrame() error = %v", err)
+	}
+	if c := s.credential(t); c.Tag != 2 {
+		t.Errorf("got %v, want tag 2", c)
+	}
+}
+
+func TestReaderOverflowSplit(t *testing.T) {
+	s := newSimReader(t, wiegand.Config{MaxBits: 26, Overflow: wiegand.OverflowSplit})
+	first, _ := wiegand.Format26.Encode(7, 100)
+	second, _ := wiegand.Format26.Encode(7, 200)
+	// Two frames separated by less than the frame timeout run together.
+	pause := wiegandtest.Pause(25, 5*time.Millisecond)
+	if err := s.line.SendWith(append(first, second...), pause); err != nil {
+		t.Fatalf("SendWith() error = %v", err)
+	}
+	var tags []uint64
+	var oe *wiegand.OverflowError
+	for len(tags) < 2 || oe == nil {
+		select {
+		case c := <-s.creds:
+			tags = append(tags, c.Tag)
+		case err := <-s.errs:
+			if !errors.As(err, &oe) || oe.Policy != wiegand.OverflowSplit {
+				t.Fatalf("got error %v, want split overflow", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("got tags %v and overflow %v, want two tags and an overflow", tags, oe)
+		}
+	}
+	if !slices.Equal(tags, []uint64{100, 200}) {
+		t.Errorf("got tags %v, want [100 200]", tags)
+	}
+}
+
+func TestReaderStuckLine(t *testing.T) {
+	s := newSimReader(t, wiegand.Config{StuckLineTimeout: 50 * time.Millisecond})
+	chatter := make([]byte, 100)
+	for i := range chatter {
+		chatter[i] = 1
+	}
+	if err := s.line.Send(chatter); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	var sle *wiegand.StuckLineError
+	for sle == nil {
+		err := s.error(t)
+		var oe *wiegand.OverflowError
+		if !errors.As(err, &sle) && !errors.As(err, &oe) {
+			t.Fatalf("got error %v, want overflow or stuck line", err)
+		}
+	}
+	if sle.Line != 1 || sle.Edges[0] != 0 {
+		t.Errorf("got %+v, want D1 stuck", sle)
+	}
+	select {
+	case err := <-s.errs:
+		var oe *wiegand.OverflowError
+		if !errors.As(err, &oe) {
+			t.Errorf("got error %v after stuck line, want no further errors", err)
+		}
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestReaderGlitchFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   wiegand.Config
+		fault wiegandtest.Fault
+		want  wiegand.Stats
+	}{
+		{
+			name:  "pulse width",
+			cfg:   wiegand.Config{MinPulseWidth: 10 * time.Microsecond},
+			fault: wiegandtest.Noise(3, 0),
+			want:  wiegand.Stats{Edges: 54, Bits: 26, ShortPulses: 1},
+		},
+		{
+			name:  "bit interval",
+			cfg:   wiegand.Config{MinBitInterval: 300 * time.Microsecond},
+			fault: wiegandtest.Noise(3, 1),
+			want:  wiegand.Stats{Edges: 27, Bits: 26, ShortIntervals: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSimReader(t, tt.cfg)
+			bits, _ := wiegand.Format26.Encode(15, 54321)
+			if err := s.line.SendWith(bits, tt.fault); err != nil {
+				t.Fatalf("SendWith() error = %v", err)
+			}
+			if c := s.credential(t); c.Site != 15 || c.Tag != 54321 {
+				t.Errorf("got %v, want 26-bit 15:54321", c)
+			}
+			if got := s.Stats(); got != tt.want {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestReaderPulseWidthNeedsEdgeDirection(t *testing.T) {
+	_, err := wiegand.New(context.Background(), wiegand.Config{
+		D0Pin: "GPIO4", D1Pin: "GPIO17", MinPulseWidth: 10 * time.Microsecond,
+	})
+	if err == nil || !strings.Contains(err.Error(), "edge direction") {
+		t.Errorf("New() with MinPulseWidth on PeriphBackend error = %v, want edge direction error", err)
+	}
+}
+
+func TestReaderLogger(t *testing.T) {
+	for _, logCredentials := range []bool{false, true} {
+		var out syncBuffer
+		line := wiegandtest.NewLine()
+		line.Interval = time.Millisecond
+		creds := make(chan wiegand.Credential, 1)
+		r, err := wiegand.New(context.Background(), wiegand.Config{
+			D0Pin:              "D0",
+			D1Pin:              "D1",
+			Backend:            line,
+			CredentialCallback: func(c wiegand.Credential) { creds <- c },
+			Timeout:            20 * time.Millisecond,
+			Logger:             slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug})),
+			LogCredentials:     logCredentials,
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		bad, _ := wiegand.Format26.Encode(15, 54321)
+		bad[25] ^= 1
+		good, _ := wiegand.Format26.Encode(15, 54321)
+		for _, bits := range [][]byte{bad, good} {
+			if err := line.Send(bits); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		<-creds
+		r.Close()
+
+		log := out.String()
+		for _, msg := range []string{"frame received", "credential read", "read error", "Invalid parity"} {
+			if !strings.Contains(log, msg) {
+				t.Errorf("LogCredentials=%v: log is missing %q:\n%s", logCredentials, msg, log)
+			}
+		}
+		if got := strings.Contains(log, "54321"); got != logCredentials {
+			t.Errorf("LogCredentials=%v: log contains tag = %v:\n%s", logCredentials, got, log)
+		}
+	}
+}
+
+// newEventReader returns a Reader without callbacks on a simulated line.
+func newEventReader(t *testing.T, cfg wiegand.Config) (*wiegand.Reader, *wiegandtest.Line) {
+	t.Helper()
+	line := wiegandtest.NewLine()
+	line.Interval = time.Millisecond
+	cfg.D0Pin, cfg.D1Pin = "D0", "D1"
+	cfg.Backend = line
+	cfg.Timeout = 20 * time.Millisecond
+	r, err := wiegand.New(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r, line
+}
+
+func TestReaderRead(t *testing.T) {
+	r, line := newEventReader(t, wiegand.Config{Name: "events"})
+	go func() {
+		bad, _ := wiegand.Format26.Encode(1, 1)
+		bad[0] ^= 1
+		for _, tag := range []uint64{1001, 1002} {
+			if err := line.SendFrame(wiegand.Format26, 1, tag); err != nil {
+				t.Errorf("SendFrame() error = %v", err)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		if err := line.Send(bad); err != nil {
+			t.Errorf("Send() error = %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		r.Close()
+	}()
+
+	var got []string
+	for ev := range r.Read() {
+		if ev.Reader != "events" {
+			t.Errorf("event Reader = %q, want events", ev.Reader)
+		}
+		switch {
+		case ev.Credential != nil:
+			got = append(got, ev.Credential.String())
+		case ev.Err != nil:
+			got = append(got, ev.Err.Error())
+		}
+	}
+	want := []string{"26-bit 1:1001", "26-bit 1:1002", "Invalid parity for 26-bit tag: 1 (1)"}
+	if !slices.Equal(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+func TestReaderBackpressure(t *testing.T) {
+	tests := []struct {
+		policy wiegand.Backpressure
+		want   uint64 // Tag of the buffered event
+	}{
+		{wiegand.BackpressureDropOldest, 3},
+		{wiegand.BackpressureDropNewest, 1},
+	}
+	for _, tt := range tests {
+		r, line := newEventReader(t, wiegand.Config{EventBuffer: 1, Backpressure: tt.policy})
+		for tag := uint64(1); tag <= 3; tag++ {
+			if err := line.SendFrame(wiegand.Format26, 1, tag); err != nil {
+				t.Fatalf("SendFrame() error = %v", err)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		if got := r.Stats().DroppedEvents; got != 2 {
+			t.Errorf("policy %d: DroppedEvents = %d, want 2", tt.policy, got)
+		}
+		if ev := <-r.Events(); ev.Credential == nil || ev.Credential.Tag != tt.want {
+			t.Errorf("policy %d: got event %+v, want tag %d", tt.policy, ev, tt.want)
+		}
+	}
+}
+
+func TestReaderCloseReleasesGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	line := wiegandtest.NewLine()
+	line.Interval = time.Millisecond
+	for i := 0; i < 3; i++ {
+		// Each Reader reopens the same lines as soon as the last is closed.
+		creds := make(chan wiegand.Credential, 1)
+		r, err := wiegand.New(context.Background(), wiegand.Config{
+			D0Pin:              "D0",
+			D1Pin:              "D1",
+			Backend:            line,
+			CredentialCallback: func(c wiegand.Credential) { creds <- c },
+			ErrorHandler:       func(err error) { t.Errorf("unexpected error %v", err) },
+			Timeout:            20 * time.Millisecond,
+			Keypad:             wiegand.KeypadConfig{Enabled: true},
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		if err := line.SendFrame(wiegand.Format26, 1, uint64(i)); err != nil {
+			t.Fatalf("SendFrame() error = %v", err)
+		}
+		<-creds
+		if err := r.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+		if _, ok := <-r.Events(); ok {
+			t.Error("event channel still open after Close")
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		buf := make([]byte, 1<<16)
+		t.Errorf("%d goroutines before, %d after Close:\n%s", before, n, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestReaderCloseFlush(t *testing.T) {
+	for _, policy := range []wiegand.ClosePolicy{wiegand.CloseDiscard, wiegand.CloseFlush} {
+		line := wiegandtest.NewLine()
+		line.Interval = time.Millisecond
+		r, err := wiegand.New(context.Background(), wiegand.Config{
+			D0Pin:   "D0",
+			D1Pin:   "D1",
+			Backend: line,
+			Timeout: time.Hour,
+			OnClose: policy,
+		})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		if err := line.SendFrame(wiegand.Format26, 7, 777); err != nil {
+			t.Fatalf("SendFrame() error = %v", err)
+		}
+		r.Close()
+		var got []wiegand.Event
+		for ev := range r.Read() {
+			got = append(got, ev)
+		}
+		switch {
+		case policy == wiegand.CloseDiscard && len(got) != 0:
+			t.Errorf("CloseDiscard: got events %+v, want none", got)
+		case policy == wiegand.CloseFlush && (len(got) != 1 || got[0].Credential == nil || got[0].Credential.Tag != 777):
+			t.Errorf("CloseFlush: got events %+v, want the 26-bit 7:777 credential", got)
+		}
+	}
+}
+
+func TestReaderDuplicates(t *testing.T) {
+	for _, policy := range []wiegand.DuplicatePolicy{wiegand.DuplicateDrop, wiegand.DuplicateFlag} {
+		r, line := newEventReader(t, wiegand.Config{DuplicateWindow: 200 * time.Millisecond, Duplicates: policy})
+		send := func(tag uint64) {
+			t.Helper()
+			if err := line.SendFrame(wiegand.Format26, 1, tag); err != nil {
+				t.Fatalf("SendFrame() error = %v", err)
+			}
+			time.Sleep(40 * time.Millisecond)
+		}
+		// A card held against the reader, then another card.
+		for range 3 {
+			send(1)
+		}
+		send(2)
+		// The first card again, once the window has passed.
+		time.Sleep(200 * time.Millisecond)
+		send(1)
+		r.Close()
+
+		type read struct {
+			tag       uint64
+			duplicate bool
+		}
+		var got []read
+		for ev := range r.Read() {
+			if ev.Credential == nil {
+				t.Fatalf("policy %d: got event %+v, want credential", policy, ev)
+			}
+			got = append(got, read{ev.Credential.Tag, ev.Credential.Duplicate})
+		}
+		want := []read{{1, false}, {2, false}, {1, false}}
+		if policy == wiegand.DuplicateFlag {
+			want = []read{{1, false}, {1, true}, {1, true}, {2, false}, {1, false}}
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("policy %d: reads = %v, want %v", policy, got, want)
+		}
+		if n := r.Stats().Duplicates; n != 2 {
+			t.Errorf("policy %d: Stats().Duplicates = %d, want 2", policy, n)
+		}
+	}
+}
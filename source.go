@@ -0,0 +1,66 @@
+package wiegand
+
+import (
+	"errors"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// ErrUnknownLine is returned by a Backend asked to open a line it does not
+// recognize.
+var ErrUnknownLine = errors.New("unknown line")
+
+// ErrClosed is returned by an EdgeSource after it has been closed.
+var ErrClosed = errors.New("edge source closed")
+
+// Edge is a transition observed on a Wiegand data line.
+type Edge struct {
+	Time time.Time // When the edge occurred
+	// Rising is true for a rising edge, which ends a Wiegand data pulse,
+	// and false for a falling edge, which starts one. Sources opened for
+	// falling edges only never report rising edges.
+	Rising bool
+	// Seq orders edges from sources sharing a sequence, e.g. lines in the
+	// same kernel line request. It is zero for sources without one.
+	Seq uint64
+	// SeqGroup identifies the sequence Seq belongs to, such as the kernel
+	// line request of an OpenPair. Seq only orders edges of the same
+	// nonzero SeqGroup; others are ordered by Time.
+	SeqGroup uint64
+}
+
+// EdgeSource delivers the edges seen on a single Wiegand data line.
+type EdgeSource interface {
+	// WaitForEdge blocks until the next edge or until timeout elapses, and
+	// reports false on timeout. A non-nil error means the source has failed
+	// or been closed and will deliver no further edges.
+	WaitForEdge(timeout time.Duration) (Edge, bool, error)
+	// Close stops edge detection and releases the line. A goroutine blocked
+	// in WaitForEdge returns ErrClosed.
+	Close() error
+}
+
+// Backend opens edge sources for named data lines, e.g. GPIO pins.
+type Backend interface {
+	// Open configures the named line as an input detecting the given edges.
+	// It returns an error wrapping ErrUnknownLine if the name is not known.
+	Open(name string, edge gpio.Edge) (EdgeSource, error)
+}
+
+// EdgeDirectionBackend is implemented by backends which report the direction
+// of each edge (Edge.Rising) on lines opened for both edges. A Reader only
+// measures pulse widths, for Config.MinPulseWidth, with such a backend; a
+// backend wrapping another should report what the wrapped backend does.
+type EdgeDirectionBackend interface {
+	Backend
+	ReportsEdgeDirection() bool
+}
+
+// PairBackend is implemented by backends which can open the D0 and D1 lines
+// together, so that edges on both share one clock and sequence. A Reader
+// uses OpenPair in preference to Open when its Backend provides it.
+type PairBackend interface {
+	Backend
+	OpenPair(d0, d1 string, edge gpio.Edge) (EdgeSource, EdgeSource, error)
+}
@@ -0,0 +1,156 @@
+package wiegand
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultPINWindow is the default time allowed for a PIN to follow a card.
+const DefaultPINWindow = 10 * time.Second
+
+// ErrPINTimeout is reported when no PIN follows a card within the window.
+var ErrPINTimeout = errors.New("timed out waiting for PIN")
+
+// ErrNoCard is reported when a PIN is entered without a preceding card.
+var ErrNoCard = errors.New("PIN entered without a card")
+
+// ErrCardReplaced is reported when a second card is presented at a reader
+// which is still waiting for the PIN of a first card.
+var ErrCardReplaced = errors.New("card replaced before PIN was entered")
+
+// CardPIN is a card credential paired with the PIN entered after it on the
+// same reader.
+type CardPIN struct {
+	Credential Credential
+	PIN        PIN
+}
+
+// TwoFactorError describes a failed card-plus-PIN sequence. Err is one of
+// ErrPINTimeout, ErrNoCard or ErrCardReplaced.
+type TwoFactorError struct {
+	Reader     string
+	Credential *Credential // The unpaired card, nil for ErrNoCard
+	Err        error
+}
+
+// Error describes the failure without the card's numbers, which are
+// available from Credential.
+func (e *TwoFactorError) Error() string {
+	if e.Credential == nil {
+		return fmt.Sprintf("reader %q: %v", e.Reader, e.Err)
+	}
+	return fmt.Sprintf("reader %q: %s card: %v", e.Reader, e.Credential.Format, e.Err)
+}
+
+func (e *TwoFactorError) Unwrap() error { return e.Err }
+
+// TwoFactorConfig holds configuration for creating a TwoFactor.
+type TwoFactorConfig struct {
+	Callback      func(CardPIN) // Receives each card paired with its PIN
+	ErrorCallback func(error)   // Receives a *TwoFactorError for failed sequences (optional)
+	Window        time.Duration // Time allowed for the PIN (default DefaultPINWindow)
+	// AfterFunc schedules the expiry of a card after Window, calling f in
+	// its own goroutine unless the returned Timer is stopped first, so that
+	// tests can control it (default time.AfterFunc).
+	AfterFunc func(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending call scheduled by TwoFactorConfig.AfterFunc.
+type Timer interface {
+	// Stop prevents the call, reporting whether it was still pending.
+	Stop() bool
+}
+
+// TwoFactor pairs each card read on a reader with the next PIN entered on
+// the same reader. Wire its Credential and PIN methods to the callbacks of
+// one or more Readers:
+//
+//	tf, err := wiegand.NewTwoFactor(wiegand.TwoFactorConfig{Callback: grant})
+//	reader, err := wiegand.New(ctx, wiegand.Config{
+//		CredentialCallback: tf.Credential,
+//		Keypad:             wiegand.KeypadConfig{PINCallback: tf.PIN},
+//		...
+//	})
+type TwoFactor struct {
+	cfg     TwoFactorConfig
+	mu      sync.Mutex
+	pending map[string]*pendingCard // Cards awaiting a PIN, by reader name
+}
+
+// pendingCard is a card waiting for its PIN.
+type pendingCard struct {
+	cred  Credential
+	timer Timer
+}
+
+// NewTwoFactor creates a TwoFactor. The callbacks are called synchronously
+// from Credential, PIN, or the timer expiring a card, so they should return
+// promptly.
+func NewTwoFactor(cfg TwoFactorConfig) (*TwoFactor, error) {
+	if cfg.Callback == nil {
+		return nil, errors.New("Callback must be specified")
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultPINWindow
+	}
+	if cfg.ErrorCallback == nil {
+		cfg.ErrorCallback = func(error) {}
+	}
+	if cfg.AfterFunc == nil {
+		cfg.AfterFunc = func(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+	}
+	return &TwoFactor{cfg: cfg, pending: make(map[string]*pendingCard)}, nil
+}
+
+// Credential starts a sequence with a card read on c.Reader.
+func (tf *TwoFactor) Credential(c Credential) {
+	tf.mu.Lock()
+	old, replaced := tf.pending[c.Reader]
+	if replaced {
+		old.timer.Stop()
+	}
+	p := &pendingCard{cred: c}
+	p.timer = tf.cfg.AfterFunc(tf.cfg.Window, func() { tf.expire(p) })
+	tf.pending[c.Reader] = p
+	tf.mu.Unlock()
+	if replaced {
+		tf.fail(c.Reader, &old.cred, ErrCardReplaced)
+	}
+}
+
+// PIN completes the sequence waiting on pin.Reader.
+func (tf *TwoFactor) PIN(pin PIN) {
+	tf.mu.Lock()
+	p, ok := tf.pending[pin.Reader]
+	if ok {
+		p.timer.Stop()
+		delete(tf.pending, pin.Reader)
+	}
+	tf.mu.Unlock()
+	if !ok {
+		tf.fail(pin.Reader, nil, ErrNoCard)
+		return
+	}
+	tf.cfg.Callback(CardPIN{Credential: p.cred, PIN: pin})
+}
+
+// expire abandons p if it is still waiting for a PIN.
+func (tf *TwoFactor) expire(p *pendingCard) {
+	tf.mu.Lock()
+	current := tf.pending[p.cred.Reader] == p
+	if current {
+		delete(tf.pending, p.cred.Reader)
+	}
+	tf.mu.Unlock()
+	if current {
+		tf.fail(p.cred.Reader, &p.cred, ErrPINTimeout)
+	}
+}
+
+// fail reports a failed sequence. tf.mu must not be held, so that the
+// callback may call back into tf.
+func (tf *TwoFactor) fail(reader string, c *Credential, err error) {
+	tf.cfg.ErrorCallback(&TwoFactorError{Reader: reader, Credential: c, Err: err})
+}
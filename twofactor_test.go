@@ -0,0 +1,118 @@
+package wiegand_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+// manualTimer is a wiegand.Timer which only fires when the test calls Fire.
+type manualTimer struct {
+	mu      sync.Mutex
+	f       func()
+	pending bool
+}
+
+func (t *manualTimer) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	was := t.pending
+	t.pending = false
+	return was
+}
+
+// Fire calls the timer's function if it is still pending.
+func (t *manualTimer) Fire() {
+	if t.Stop() {
+		t.f()
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	pairs := make(chan wiegand.CardPIN, 1)
+	errs := make(chan error, 1)
+	timers := make(chan *manualTimer, 2)
+	tf, err := wiegand.NewTwoFactor(wiegand.TwoFactorConfig{
+		Callback:      func(cp wiegand.CardPIN) { pairs <- cp },
+		ErrorCallback: func(err error) { errs <- err },
+		Window:        time.Minute,
+		AfterFunc: func(d time.Duration, f func()) wiegand.Timer {
+			if d != time.Minute {
+				t.Errorf("AfterFunc(%v), want the window of 1m", d)
+			}
+			timer := &manualTimer{f: f, pending: true}
+			timers <- timer
+			return timer
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTwoFactor() error = %v", err)
+	}
+	s := newSimReader(t, wiegand.Config{
+		Name:   "door",
+		Keypad: wiegand.KeypadConfig{PINCallback: tf.PIN},
+	})
+	// Route credentials through both the test harness and the pairer.
+	go func() {
+		for c := range s.creds {
+			tf.Credential(c)
+		}
+	}()
+
+	s.line.SendFrame(wiegand.Format26, 1, 1001)
+	var first *manualTimer
+	select {
+	case first = <-timers: // The card is waiting for its PIN
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the card")
+	}
+	for _, k := range []byte{4, 2, 11} {
+		s.line.Send(keyBurst(k, true))
+		time.Sleep(30 * time.Millisecond)
+	}
+	select {
+	case cp := <-pairs:
+		if cp.Credential.Tag != 1001 || cp.PIN.Digits != "42" || cp.PIN.Reader != "door" {
+			t.Errorf("got %+v, want tag 1001 with PIN 42 on door", cp)
+		}
+	case err := <-errs:
+		t.Fatalf("got error %v, want card and PIN", err)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for card and PIN")
+	}
+
+	// The PIN stopped the first card's timer, so it no longer expires.
+	if first.Stop() {
+		t.Error("timer of a paired card still pending, want it stopped")
+	}
+
+	tf.Credential(wiegand.Credential{Reader: "door", Format: "26-bit", Site: 1, Tag: 1002})
+	(<-timers).Fire()
+	select {
+	case err := <-errs:
+		var tfe *wiegand.TwoFactorError
+		if !errors.Is(err, wiegand.ErrPINTimeout) || !errors.As(err, &tfe) || tfe.Credential.Tag != 1002 {
+			t.Errorf("got error %v, want PIN timeout for tag 1002", err)
+		}
+		if strings.Contains(err.Error(), "1002") {
+			t.Errorf("Error() = %q, want the card numbers left out", err)
+		}
+	default:
+		t.Fatal("no error after the window expired, want PIN timeout")
+	}
+
+	tf.PIN(wiegand.PIN{Reader: "door", Digits: "1"})
+	if err := <-errs; !errors.Is(err, wiegand.ErrNoCard) {
+		t.Errorf("got error %v, want ErrNoCard", err)
+	}
+}
+
+func TestTwoFactorRequiresCallback(t *testing.T) {
+	if _, err := wiegand.NewTwoFactor(wiegand.TwoFactorConfig{}); err == nil {
+		t.Error("NewTwoFactor() without a Callback succeeded, want error")
+	}
+}
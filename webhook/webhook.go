@@ -0,0 +1,397 @@
+// Package webhook POSTs the events of Wiegand readers to an HTTP endpoint.
+// Each request body is the JSON encoding of one wiegand.Event. Events are
+// queued, optionally on disk so that they survive a restart, and delivered
+// in order: a failed delivery is retried with exponential backoff before
+// any later event is sent.
+//
+//	pub, err := webhook.New(webhook.Config{
+//		URL:      "https://example.com/badge",
+//		Secret:   []byte("shared secret"),
+//		QueueDir: "/var/lib/wiegandd/webhook",
+//	})
+//	...
+//	for ev := range manager.Read() {
+//		pub.Publish(ev)
+//	}
+//
+// Requests carry these headers:
+//
+//	Content-Type: application/json
+//	X-Wiegand-Delivery: <delivery ID, unique to the event and the same for every retry>
+//	X-Wiegand-Timestamp: <Unix time of the attempt, in seconds>
+//	X-Wiegand-Signature: sha256=<hex HMAC-SHA256 of the timestamp, ".", and the body>
+//
+// The signature is only sent when Config.Secret is set. Receivers should
+// check it with Verify, which also rejects old timestamps so that a captured
+// request cannot be replayed, and can use the delivery ID to discard the
+// duplicates a retry after a lost response can cause.
+package webhook
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+// Defaults for Config.
+const (
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 5 * time.Minute
+	DefaultMaxPending = 10000
+	DefaultTimeout    = 10 * time.Second
+)
+
+// Header names set on each request.
+const (
+	SignatureHeader = "X-Wiegand-Signature"
+	TimestampHeader = "X-Wiegand-Timestamp"
+	DeliveryHeader  = "X-Wiegand-Delivery"
+)
+
+// Config holds configuration for creating a Publisher.
+type Config struct {
+	URL    string // Endpoint events are POSTed to
+	Secret []byte // Key for the HMAC-SHA256 signature header (optional)
+	// Types lists the event types to send, as returned by
+	// wiegand.Event.Type (default: only "credential").
+	Types []string
+	// QueueDir stores undelivered events, one file each, so that they are
+	// delivered after a restart. Optional; without it events are queued in
+	// memory and lost on Close.
+	QueueDir string
+	// MaxPending is the most undelivered events kept (default
+	// DefaultMaxPending). Events published while it is reached are dropped
+	// and reported.
+	MaxPending int
+	MinBackoff time.Duration // First retry delay (default DefaultMinBackoff)
+	MaxBackoff time.Duration // Longest retry delay (default DefaultMaxBackoff)
+	// Client sends the requests. Optional; defaults to a client with a
+	// DefaultTimeout timeout.
+	Client *http.Client
+	// ErrorHandler is called with failed deliveries and dropped events.
+	// Optional.
+	ErrorHandler func(error)
+}
+
+// DeliveryError reports a failed attempt to deliver an event.
+type DeliveryError struct {
+	Delivery string // Delivery ID
+	Status   int    // HTTP status, or 0 if no response was received
+	Err      error  // Transport error, if no response was received
+	// Dropped is true if the event was given up on because the endpoint
+	// rejected it with a 4xx status; otherwise it will be retried.
+	Dropped bool
+}
+
+func (e *DeliveryError) Error() string {
+	action := "will retry"
+	if e.Dropped {
+		action = "dropped"
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("webhook delivery %s failed (%s): %v", e.Delivery, action, e.Err)
+	}
+	return fmt.Sprintf("webhook delivery %s failed (%s): HTTP %d", e.Delivery, action, e.Status)
+}
+
+func (e *DeliveryError) Unwrap() error { return e.Err }
+
+// ErrQueueFull is reported when an event is dropped because MaxPending
+// events are already waiting.
+var ErrQueueFull = errors.New("webhook queue full, event dropped")
+
+// item is a queued event. Its delivery ID is made of the epoch of the
+// Publisher which queued it and its sequence number within that Publisher,
+// so that IDs are not reused after a restart.
+type item struct {
+	epoch int64 // Start time of the queueing Publisher, in Unix nanoseconds
+	seq   uint64
+	body  []byte
+}
+
+func (it item) id() string {
+	return fmt.Sprintf("%d-%d", it.epoch, it.seq)
+}
+
+// Publisher delivers events to a webhook. It is safe for concurrent use.
+type Publisher struct {
+	cfg    Config
+	types  map[string]bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{} // Closed when run exits
+
+	epoch int64 // Epoch of the events queued by this Publisher
+
+	mu      sync.Mutex
+	pending []item
+	seq     uint64        // Sequence number of the last queued event
+	wake    chan struct{} // Signals run that an event was queued
+}
+
+// New creates a Publisher, loading any events left in Config.QueueDir, and
+// starts delivering.
+func New(cfg Config) (*Publisher, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("webhook URL must be specified")
+	}
+	if len(cfg.Types) == 0 {
+		cfg.Types = []string{"credential"}
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = DefaultMaxPending
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(DefaultMaxBackoff, cfg.MinBackoff)
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+	p := &Publisher{
+		cfg:   cfg,
+		types: make(map[string]bool),
+		epoch: time.Now().UnixNano(),
+		done:  make(chan struct{}),
+		wake:  make(chan struct{}, 1),
+	}
+	for _, t := range cfg.Types {
+		p.types[t] = true
+	}
+	if cfg.QueueDir != "" {
+		if err := p.load(); err != nil {
+			return nil, err
+		}
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	go p.run()
+	return p, nil
+}
+
+// load reads the events queued in QueueDir by a previous Publisher.
+func (p *Publisher) load() error {
+	if err := os.MkdirAll(p.cfg.QueueDir, 0o700); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(p.cfg.QueueDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue // Including partially written ".tmp" files
+		}
+		epoch, seq, ok := strings.Cut(name, "-")
+		if !ok {
+			continue
+		}
+		var it item
+		var err1, err2 error
+		it.epoch, err1 = strconv.ParseInt(epoch, 10, 64)
+		it.seq, err2 = strconv.ParseUint(seq, 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if it.body, err = os.ReadFile(filepath.Join(p.cfg.QueueDir, e.Name())); err != nil {
+			return err
+		}
+		p.pending = append(p.pending, it)
+		// Order new events after these, even if the clock has gone back.
+		p.epoch = max(p.epoch, it.epoch+1)
+	}
+	slices.SortFunc(p.pending, func(a, b item) int {
+		return cmp.Or(cmp.Compare(a.epoch, b.epoch), cmp.Compare(a.seq, b.seq))
+	})
+	return nil
+}
+
+// path returns the queue file of an event.
+func (p *Publisher) path(it item) string {
+	return filepath.Join(p.cfg.QueueDir, fmt.Sprintf("%020d-%020d.json", it.epoch, it.seq))
+}
+
+// Publish queues an event for delivery, if it is of one of Config.Types.
+func (p *Publisher) Publish(ev wiegand.Event) {
+	if !p.types[ev.Type()] {
+		return
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		p.report(err)
+		return
+	}
+	p.mu.Lock()
+	if len(p.pending) >= p.cfg.MaxPending {
+		p.mu.Unlock()
+		p.report(ErrQueueFull)
+		return
+	}
+	p.seq++
+	it := item{epoch: p.epoch, seq: p.seq, body: body}
+	if p.cfg.QueueDir != "" {
+		// Write then rename, so a crash never leaves a truncated event.
+		tmp := p.path(it) + ".tmp"
+		err := os.WriteFile(tmp, body, 0o600)
+		if err == nil {
+			err = os.Rename(tmp, p.path(it))
+		}
+		if err != nil {
+			p.mu.Unlock()
+			p.report(fmt.Errorf("queueing webhook event: %w", err))
+			return
+		}
+	}
+	p.pending = append(p.pending, it)
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pending returns the number of events waiting to be delivered.
+func (p *Publisher) Pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending)
+}
+
+// Close stops delivering, abandoning any request in progress. Undelivered
+// events remain in QueueDir for the next Publisher.
+func (p *Publisher) Close() error {
+	p.cancel()
+	<-p.done
+	return nil
+}
+
+func (p *Publisher) report(err error) {
+	if p.cfg.ErrorHandler != nil {
+		p.cfg.ErrorHandler(err)
+	}
+}
+
+// run delivers queued events in order until Close.
+func (p *Publisher) run() {
+	defer close(p.done)
+	backoff := time.Duration(0)
+	for {
+		p.mu.Lock()
+		var it item
+		ok := len(p.pending) > 0
+		if ok {
+			it = p.pending[0]
+		}
+		p.mu.Unlock()
+		if !ok {
+			select {
+			case <-p.wake:
+				continue
+			case <-p.ctx.Done():
+				return
+			}
+		}
+
+		err := p.deliver(it)
+		if p.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			p.report(err)
+			if !err.Dropped {
+				backoff = min(max(2*backoff, p.cfg.MinBackoff), p.cfg.MaxBackoff)
+				select {
+				case <-time.After(backoff):
+				case <-p.ctx.Done():
+					return
+				}
+				continue
+			}
+		}
+		backoff = 0
+		p.remove(it)
+	}
+}
+
+// remove takes a delivered or dropped event off the queue.
+func (p *Publisher) remove(it item) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = p.pending[1:]
+	if p.cfg.QueueDir != "" {
+		if err := os.Remove(p.path(it)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			p.report(fmt.Errorf("removing delivered webhook event: %w", err))
+		}
+	}
+}
+
+// deliver makes one attempt to POST an event.
+func (p *Publisher) deliver(it item) *DeliveryError {
+	req, err := http.NewRequestWithContext(p.ctx, http.MethodPost, p.cfg.URL, bytes.NewReader(it.body))
+	if err != nil {
+		return &DeliveryError{Delivery: it.id(), Err: err, Dropped: true}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, it.id())
+	req.Header.Set(TimestampHeader, timestamp)
+	if len(p.cfg.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(p.cfg.Secret, timestamp, it.body))
+	}
+	resp, err := p.cfg.Client.Do(req)
+	if err != nil {
+		return &DeliveryError{Delivery: it.id(), Err: err}
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return &DeliveryError{Delivery: it.id(), Status: resp.StatusCode, Dropped: true}
+	}
+	return &DeliveryError{Delivery: it.id(), Status: resp.StatusCode}
+}
+
+// Sign returns the signature header value for a request with the given
+// timestamp header value and body: "sha256=" followed by the hex encoded
+// HMAC-SHA256, keyed with secret, of the timestamp, ".", and the body.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is a valid signature header value for
+// timestamp and body, comparing in constant time, and whether timestamp is
+// within maxAge of the current time. A maxAge of a few minutes allows for
+// clock skew while limiting how long a captured request can be replayed.
+func Verify(secret []byte, timestamp string, body []byte, signature string, maxAge time.Duration) bool {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := time.Since(time.Unix(sec, 0)); age > maxAge || age < -maxAge {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
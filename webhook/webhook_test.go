@@ -0,0 +1,227 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asjoyner/wiegand-go"
+	"github.com/asjoyner/wiegand-go/webhook"
+)
+
+var secret = []byte("s3cret")
+
+// delivery is a request accepted by testEndpoint.
+type delivery struct {
+	id  string
+	tag uint64
+}
+
+// testEndpoint is a webhook receiver which verifies signatures, and fails
+// the requests for which fail returns true.
+type testEndpoint struct {
+	*httptest.Server
+	deliveries chan delivery
+
+	mu       sync.Mutex
+	requests int
+	fail     func(n int) bool // Called with the 1-based request count
+}
+
+func newTestEndpoint(t *testing.T, fail func(n int) bool) *testEndpoint {
+	t.Helper()
+	e := &testEndpoint{deliveries: make(chan delivery, 100), fail: fail}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.mu.Lock()
+		e.requests++
+		failed := e.fail(e.requests)
+		e.mu.Unlock()
+		if failed {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !webhook.Verify(secret, r.Header.Get(webhook.TimestampHeader), body, r.Header.Get(webhook.SignatureHeader), time.Minute) {
+			t.Errorf("request with invalid signature %q", r.Header.Get(webhook.SignatureHeader))
+		}
+		var ev struct{ Tag uint64 }
+		if err := json.Unmarshal(body, &ev); err != nil {
+			t.Errorf("decoding %s: %v", body, err)
+		}
+		e.deliveries <- delivery{id: r.Header.Get(webhook.DeliveryHeader), tag: ev.Tag}
+	}))
+	t.Cleanup(e.Close)
+	return e
+}
+
+func (e *testEndpoint) setFail(fail func(n int) bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fail = fail
+}
+
+func credential(tag uint64) wiegand.Event {
+	return wiegand.Event{
+		Reader:     "door",
+		Time:       time.Now(),
+		Credential: &wiegand.Credential{Reader: "door", Format: "26-bit", Site: 1, Tag: tag},
+	}
+}
+
+// expect waits for deliveries of the given tags, in order. Repeated
+// deliveries, which a request abandoned by Close can cause, are ignored as
+// a receiver would by their delivery ID.
+func (e *testEndpoint) expect(t *testing.T, tags ...uint64) {
+	t.Helper()
+	seen := make(map[string]bool)
+	for i := 0; i < len(tags); {
+		select {
+		case d := <-e.deliveries:
+			if seen[d.id] {
+				continue
+			}
+			seen[d.id] = true
+			if d.tag != tags[i] {
+				t.Fatalf("delivery %d was tag %d, want %d", i, d.tag, tags[i])
+			}
+			i++
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for delivery of tag %d", tags[i])
+		}
+	}
+}
+
+// drain waits for pub to have no pending events.
+func drain(t *testing.T, pub *webhook.Publisher) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for pub.Pending() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Pending() = %d after delivery, want 0", pub.Pending())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPublisherRetries(t *testing.T) {
+	// Every third request fails.
+	endpoint := newTestEndpoint(t, func(n int) bool { return n%3 == 0 })
+	var mu sync.Mutex
+	var errs []error
+	pub, err := webhook.New(webhook.Config{
+		URL:        endpoint.URL,
+		Secret:     secret,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+		ErrorHandler: func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pub.Close()
+
+	for tag := uint64(1); tag <= 6; tag++ {
+		pub.Publish(credential(tag))
+	}
+	pub.Publish(wiegand.Event{Reader: "door", Err: errors.New("not sent")})
+	endpoint.expect(t, 1, 2, 3, 4, 5, 6)
+	drain(t, pub)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var de *webhook.DeliveryError
+	if len(errs) < 2 || !errors.As(errs[0], &de) || de.Status != http.StatusServiceUnavailable || de.Dropped {
+		t.Errorf("reported errors = %v, want retried HTTP 503 failures", errs)
+	}
+}
+
+func TestPublisherQueueDir(t *testing.T) {
+	dir := t.TempDir()
+	endpoint := newTestEndpoint(t, func(int) bool { return true })
+	cfg := webhook.Config{
+		URL:        endpoint.URL,
+		Secret:     secret,
+		QueueDir:   dir,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 5 * time.Millisecond,
+	}
+	pub, err := webhook.New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for tag := uint64(1); tag <= 3; tag++ {
+		pub.Publish(credential(tag))
+	}
+	time.Sleep(20 * time.Millisecond)
+	pub.Close()
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Fatalf("queue holds %d files during the outage, want 3", len(entries))
+	}
+
+	// After a restart with the endpoint back, the queued events are sent
+	// first, in order.
+	endpoint.setFail(func(int) bool { return false })
+	pub, err = webhook.New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pub.Close()
+	pub.Publish(credential(4))
+	endpoint.expect(t, 1, 2, 3, 4)
+	drain(t, pub)
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("queue holds %d files after delivery, want 0", len(entries))
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"credential"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := webhook.Sign(secret, now, body)
+	if !webhook.Verify(secret, now, body, sig, time.Minute) {
+		t.Errorf("Verify(Sign()) = false")
+	}
+	if webhook.Verify([]byte("other"), now, body, sig, time.Minute) {
+		t.Errorf("Verify() with the wrong secret = true")
+	}
+	if webhook.Verify(secret, "1", body, sig, time.Minute) {
+		t.Errorf("Verify() with a changed timestamp = true")
+	}
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	if webhook.Verify(secret, old, body, webhook.Sign(secret, old, body), time.Minute) {
+		t.Errorf("Verify() of an hour old request = true")
+	}
+}
+
+func TestDeliveryIDsNotReused(t *testing.T) {
+	// Each Publisher drains its queue before the next starts, as after a
+	// restart, but the delivery IDs must still differ.
+	dir := t.TempDir()
+	endpoint := newTestEndpoint(t, func(int) bool { return false })
+	seen := make(map[string]bool)
+	for range 2 {
+		pub, err := webhook.New(webhook.Config{URL: endpoint.URL, Secret: secret, QueueDir: dir})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		pub.Publish(credential(1))
+		drain(t, pub)
+		pub.Close()
+		d := <-endpoint.deliveries
+		if seen[d.id] {
+			t.Errorf("delivery ID %q reused after a restart", d.id)
+		}
+		seen[d.id] = true
+	}
+}
@@ -1,133 +1,468 @@
 // Package wiegand provides a thread-safe library for reading Wiegand protocol data
 // from Raspberry Pi GPIO pins. It supports configurable D0 and D1 pins and delivers
-// received data to a user-provided callback function as a string of digits.
+// each decoded frame to a user-provided callback function as a Credential.
 package wiegand
 
 import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
 	"sync"
 	"time"
 
 	"periph.io/x/conn/v3/gpio"
-	"periph.io/x/conn/v3/gpio/gpioreg"
-	"periph.io/x/host/v3"
 )
 
 // Reader represents a Wiegand reader instance, managing GPIO pins and data collection.
 type Reader struct {
-	d0, d1      gpio.PinIO // GPIO pins for Wiegand D0 and D1
-	data        []byte     // Buffer for collecting Wiegand bits
-	lastBitTime time.Time  // Time of the last received bit
-	mu          sync.Mutex // Protects data buffer and lastBitTime
-	// Callback to receive Wiegand data, site + tag
-	callback      func(string, string)
-	errorCallback func(string) // Called on read errors (parity, unknown bit count)
-	ctx           context.Context    // Context for cancellation
-	cancel        context.CancelFunc // Cancels the reader
-	timeout       time.Duration      // Timeout for detecting end of Wiegand frame
-	maxBits       int                // Maximum bits to collect (e.g., 26 for standard Wiegand)
-	pulse         chan bool          // Signals new pulse
+	d0, d1         EdgeSource         // Edge sources for Wiegand D0 and D1
+	data           []rxBit            // Buffer for collecting Wiegand bits
+	lastBitTime    time.Time          // Time of the latest received bit
+	mu             sync.Mutex         // Protects data buffer and lastBitTime
+	name           string             // Identifies the reader in Credentials
+	callback       func(Credential)   // Receives each decoded frame, if set
+	errorCallback  func(error)        // Called on read errors (parity, unknown bit count), if set
+	keyCallback    func(Key)          // Receives each keypress, if set
+	pinCallback    func(PIN)          // Receives each completed PIN, if set
+	events         chan Event         // Delivers events in order; closed with the Reader
+	eventsMu       sync.RWMutex       // Held for reading while sending on events
+	eventsClosed   bool               // events has been closed, protected by eventsMu
+	backpressure   Backpressure       // What to do when events is full
+	logger         *slog.Logger       // Receives diagnostic messages
+	logCredentials bool               // Log credential numbers and keys instead of redacting them
+	ctx            context.Context    // Context for cancellation
+	wg             sync.WaitGroup     // Tracks watchPin and processData
+	closeOnce      sync.Once          // Makes Close idempotent
+	closeErr       error              // Result of the first Close
+	onClose        ClosePolicy        // What Close does with a partial frame
+	cancel         context.CancelFunc // Cancels the reader
+	timeout        time.Duration      // Timeout for detecting end of Wiegand frame
+	maxBits        int                // Maximum bits to collect (e.g., 26 for standard Wiegand)
+	formats        *Registry          // Known frame layouts, keyed by bit length
+	keypad         *pinAssembler      // Decodes keypad bursts, nil if disabled
+	feedback       *Feedback          // Drives the LED and beeper, nil if not configured
+	dupWindow      time.Duration      // Repeat reads within this are duplicates, if positive
+	duplicates     DuplicatePolicy    // What to do with a duplicate read
+	lastCred       Credential         // Latest credential decoded, protected by mu
+	overflow       OverflowPolicy     // What to do when a frame exceeds maxBits
+	discarding     bool               // Discarding bits until the next idle gap
+	stuckTimeout   time.Duration      // Longest burst before reporting a stuck line
+	burstStart     time.Time          // Time of the first bit since the last idle gap
+	burstEdges     [2]int             // Edges on D0 and D1 since the last idle gap
+	stuckReported  bool               // StuckLineError already reported for this burst
+	filter         glitchFilter       // Rejects edges which are not data bits
+	stats          Stats              // Activity counters, protected by mu
+	pulse          chan bool          // Signals new pulse
 }
 
 // Config holds configuration for creating a new Wiegand Reader.
 type Config struct {
+	Name         string // Identifies this reader in Credentials (optional)
 	D0Pin, D1Pin string // GPIO pin names (e.g., "GPIO14", "GPIO15")
-	// Callback to receive Wiegand data, site + tag
+	// Backend opens D0Pin and D1Pin. Optional; defaults to PeriphBackend,
+	// which reads Raspberry Pi GPIO pins.
+	Backend Backend
+	// CredentialCallback receives each decoded frame as a Credential.
+	// Callbacks are optional: without any, events are consumed through
+	// Reader.Events or Reader.Read instead. Callbacks are invoked one at a
+	// time in the order events occurred, and a slow callback delays the
+	// next according to Backpressure.
+	CredentialCallback func(Credential)
+	// Callback to receive Wiegand data, site + tag. Deprecated: use
+	// CredentialCallback, which also carries the raw bits, format and time.
+	// If both are set, only CredentialCallback is called.
 	Callback func(string, string)
-	// ErrorCallback is called on read errors (parity failures, unknown bit
-	// counts). The string describes the error. Optional; errors are logged
-	// to stdout if nil.
+	// ErrorHandler is called on read errors. The error is one of the error
+	// types in this package, such as *ParityError or *UnknownLengthError,
+	// and can be inspected with errors.As. Optional.
+	ErrorHandler func(error)
+	// ErrorCallback is called with the text of read errors. Deprecated:
+	// use ErrorHandler. If both are set, only ErrorHandler is called.
 	ErrorCallback func(string)
 	Timeout       time.Duration // Timeout for frame completion (default 100ms)
-	MaxBits       int           // Maximum bits per frame (default 26)
+	// Logger receives diagnostic messages: each received frame at Debug
+	// level, decoded credentials at Info and read errors at Warn.
+	// Optional; nothing is logged if nil.
+	Logger *slog.Logger
+	// LogCredentials includes site codes, tags, raw bits and keys in log
+	// messages, which otherwise redact them.
+	LogCredentials bool
+	// MaxBits caps the number of bits collected for one frame (default:
+	// the length of the longest registered format). Longer frames are
+	// reported with an *OverflowError and handled according to Overflow.
+	MaxBits  int
+	Overflow OverflowPolicy // Handling of frames longer than MaxBits (default OverflowDiscard)
+	// MinBitInterval rejects a bit which starts sooner than this after the
+	// previous bit, on either line. Optional.
+	MinBitInterval time.Duration
+	// MinPulseWidth rejects pulses narrower than this. Measuring pulses
+	// requires the lines to be opened for both edges with a backend which
+	// reports the direction of each edge, an EdgeDirectionBackend such as
+	// CdevBackend; New rejects it with PeriphBackend, which does not.
+	// Optional.
+	MinPulseWidth time.Duration
+	// StuckLineTimeout is how long bits may keep arriving without an idle
+	// gap before a *StuckLineError is reported (default
+	// DefaultStuckLineTimeout). Negative disables the check.
+	StuckLineTimeout time.Duration
+	// Formats are additional frame layouts to decode, on top of the
+	// built-in 26, 34 and 37-bit formats. A format replaces any built-in
+	// format with the same bit length.
+	Formats []Format
+	// Keypad enables decoding of 4 and 8-bit keypad bursts into keypresses
+	// and PINs.
+	Keypad KeypadConfig
+	// Feedback configures the reader's LED and beeper wires, driven with
+	// Reader.Feedback.
+	Feedback FeedbackConfig
+	// EventBuffer is the capacity of the event channel (default
+	// DefaultEventBuffer).
+	EventBuffer int
+	// Backpressure selects what happens to new events while the event
+	// channel is full (default BackpressureDropOldest).
+	Backpressure Backpressure
+	// OnClose selects what Close does with a frame still being received
+	// (default CloseDiscard).
+	OnClose ClosePolicy
+	// DuplicateWindow suppresses the repeated frames of a card held against
+	// the reader: a credential identical to the previous one, read within
+	// this long of it, is handled according to Duplicates. The window
+	// restarts with each repeat, so a card held for any length of time is
+	// read once. Optional.
+	DuplicateWindow time.Duration
+	Duplicates      DuplicatePolicy // Handling of duplicate reads (default DuplicateDrop)
 }
 
 // DefaultTimeout is the default duration to wait for a complete Wiegand frame.
 const DefaultTimeout = 100 * time.Millisecond
 
-// DefaultMaxBits is the default maximum number of bits for a Wiegand frame.
+// DefaultMaxBits is the length of the standard 26-bit frame. Readers
+// without Config.MaxBits accept frames up to the longest registered format,
+// which is at least this long.
 const DefaultMaxBits = 26
 
+// DefaultStuckLineTimeout is the default time bits may arrive continuously
+// before a line is reported as stuck. It is several times longer than the
+// slowest legitimate Wiegand frame.
+const DefaultStuckLineTimeout = 2 * time.Second
+
+// OverflowPolicy selects how a Reader recovers when more than MaxBits bits
+// arrive without an idle gap.
+type OverflowPolicy int
+
+const (
+	// OverflowDiscard drops the bits collected so far and all further bits
+	// until the line has been idle for the frame timeout.
+	OverflowDiscard OverflowPolicy = iota
+	// OverflowSplit assumes two frames ran together: the bits before the
+	// longest gap between edges are decoded as a frame, and collection
+	// continues with the bits after it.
+	OverflowSplit
+)
+
+// ClosePolicy selects what a Reader does with a partially received frame
+// when it is closed.
+type ClosePolicy int
+
+const (
+	// CloseDiscard drops the partial frame.
+	CloseDiscard ClosePolicy = iota
+	// CloseFlush decodes the partial frame as if the frame timeout had
+	// elapsed. If it is complete, its Credential is delivered as the final
+	// event; otherwise the usual error is.
+	CloseFlush
+)
+
+// DuplicatePolicy selects what a Reader does with a credential read again
+// within its DuplicateWindow. Duplicates are counted in Stats either way.
+type DuplicatePolicy int
+
+const (
+	// DuplicateDrop discards the repeated credential.
+	DuplicateDrop DuplicatePolicy = iota
+	// DuplicateFlag delivers the repeated credential with its Duplicate
+	// field set.
+	DuplicateFlag
+)
+
 // New creates a new Wiegand Reader for the specified D0 and D1 GPIO pins.
 func New(ctx context.Context, cfg Config) (*Reader, error) {
-	if _, err := host.Init(); err != nil {
-		return nil, fmt.Errorf("failed to initialize periph host: %w", err)
-	}
-
 	if cfg.D0Pin == "" || cfg.D1Pin == "" {
 		return nil, errors.New("D0Pin and D1Pin must be specified")
 	}
-	if cfg.Callback == nil {
-		return nil, errors.New("callback function must be provided")
-	}
 	if cfg.Timeout <= 0 {
 		cfg.Timeout = DefaultTimeout
 	}
+	formats, err := NewRegistry(cfg.Formats...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format: %w", err)
+	}
 	if cfg.MaxBits <= 0 {
-		cfg.MaxBits = DefaultMaxBits
+		for _, f := range formats.Formats() {
+			cfg.MaxBits = max(cfg.MaxBits, f.Bits)
+		}
+		if cfg.Keypad.enabled() {
+			cfg.MaxBits = max(cfg.MaxBits, 8)
+		}
+	}
+	if cfg.StuckLineTimeout == 0 {
+		cfg.StuckLineTimeout = DefaultStuckLineTimeout
+	}
+	if cfg.EventBuffer <= 0 {
+		cfg.EventBuffer = DefaultEventBuffer
 	}
 
-	d0 := gpioreg.ByName(cfg.D0Pin)
-	d1 := gpioreg.ByName(cfg.D1Pin)
-	if d0 == nil || d1 == nil {
-		return nil, fmt.Errorf("invalid GPIO pins: D0=%s, D1=%s", cfg.D0Pin, cfg.D1Pin)
+	backend := cfg.Backend
+	if backend == nil {
+		backend = PeriphBackend{}
+	}
+	edge := gpio.FallingEdge
+	if cfg.MinPulseWidth > 0 {
+		if b, ok := backend.(EdgeDirectionBackend); !ok || !b.ReportsEdgeDirection() {
+			return nil, errors.New("MinPulseWidth requires a backend reporting edge direction, such as CdevBackend")
+		}
+		edge = gpio.BothEdges
+	}
+	d0, d1, err := openPins(backend, cfg.D0Pin, cfg.D1Pin, edge)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := d0.In(gpio.PullDown, gpio.FallingEdge); err != nil {
-		return nil, fmt.Errorf("failed to configure D0 pin %s: %w", cfg.D0Pin, err)
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(discardHandler{})
+	}
+	if cfg.Name != "" {
+		logger = logger.With("reader", cfg.Name)
 	}
-	if err := d1.In(gpio.PullDown, gpio.FallingEdge); err != nil {
-		return nil, fmt.Errorf("failed to configure D1 pin %s: %w", cfg.D1Pin, err)
+
+	feedback, err := newFeedback(cfg.Feedback, logger)
+	if err != nil {
+		d0.Close()
+		d1.Close()
+		return nil, err
 	}
 
-	errCb := cfg.ErrorCallback
-	if errCb == nil {
-		errCb = func(msg string) { fmt.Println(msg) }
+	errCb := cfg.ErrorHandler
+	if errCb == nil && cfg.ErrorCallback != nil {
+		errCb = func(err error) { cfg.ErrorCallback(err.Error()) }
+	}
+	cb := cfg.CredentialCallback
+	if cb == nil && cfg.Callback != nil {
+		cb = stringCallback(cfg.Callback)
 	}
 
 	r := &Reader{
-		d0:            d0,
-		d1:            d1,
-		data:          make([]byte, 0, cfg.MaxBits),
-		callback:      cfg.Callback,
-		errorCallback: errCb,
-		timeout:       cfg.Timeout,
-		maxBits:       cfg.MaxBits,
-		pulse:         make(chan bool, 1), // Buffered to avoid blocking
+		d0:             d0,
+		d1:             d1,
+		data:           make([]rxBit, 0, cfg.MaxBits+1),
+		name:           cfg.Name,
+		callback:       cb,
+		errorCallback:  errCb,
+		keyCallback:    cfg.Keypad.KeyCallback,
+		pinCallback:    cfg.Keypad.PINCallback,
+		events:         make(chan Event, cfg.EventBuffer),
+		backpressure:   cfg.Backpressure,
+		onClose:        cfg.OnClose,
+		logger:         logger,
+		logCredentials: cfg.LogCredentials,
+		timeout:        cfg.Timeout,
+		maxBits:        cfg.MaxBits,
+		formats:        formats,
+		overflow:       cfg.Overflow,
+		stuckTimeout:   cfg.StuckLineTimeout,
+		filter:         glitchFilter{minInterval: cfg.MinBitInterval, minWidth: cfg.MinPulseWidth},
+		feedback:       feedback,
+		dupWindow:      cfg.DuplicateWindow,
+		duplicates:     cfg.Duplicates,
+		pulse:          make(chan bool, 1), // Buffered to avoid blocking
+	}
+	if cfg.Keypad.enabled() {
+		r.keypad = newPINAssembler(cfg.Keypad, r.emit)
 	}
 
 	r.ctx, r.cancel = context.WithCancel(ctx)
+	if r.callback != nil || r.errorCallback != nil || r.keyCallback != nil || r.pinCallback != nil {
+		go r.dispatch()
+	}
 
+	r.wg.Add(3)
 	go r.watchPin(r.d0, 0)
 	go r.watchPin(r.d1, 1)
 	go r.processData()
+	// Cancelling ctx closes the Reader too.
+	context.AfterFunc(r.ctx, func() { r.Close() })
 
 	return r, nil
 }
 
-// watchPin monitors a GPIO pin for falling edges and sends bits to the data buffer.
-func (r *Reader) watchPin(pin gpio.PinIO, bit byte) {
+// openPins opens the D0 and D1 lines from backend, closing D0 again if D1
+// cannot be opened.
+func openPins(backend Backend, d0Pin, d1Pin string, edge gpio.Edge) (EdgeSource, EdgeSource, error) {
+	if pb, ok := backend.(PairBackend); ok {
+		d0, d1, err := pb.OpenPair(d0Pin, d1Pin, edge)
+		if errors.Is(err, ErrUnknownLine) {
+			return nil, nil, fmt.Errorf("invalid GPIO pins: D0=%s, D1=%s", d0Pin, d1Pin)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to configure pins D0=%s, D1=%s: %w", d0Pin, d1Pin, err)
+		}
+		return d0, d1, nil
+	}
+	d0, err := backend.Open(d0Pin, edge)
+	if errors.Is(err, ErrUnknownLine) {
+		return nil, nil, fmt.Errorf("invalid GPIO pins: D0=%s, D1=%s", d0Pin, d1Pin)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to configure D0 pin %s: %w", d0Pin, err)
+	}
+	d1, err := backend.Open(d1Pin, edge)
+	if err != nil {
+		d0.Close()
+		if errors.Is(err, ErrUnknownLine) {
+			return nil, nil, fmt.Errorf("invalid GPIO pins: D0=%s, D1=%s", d0Pin, d1Pin)
+		}
+		return nil, nil, fmt.Errorf("failed to configure D1 pin %s: %w", d1Pin, err)
+	}
+	return d0, d1, nil
+}
+
+// rxBit is a received data bit and the edge which carried it.
+type rxBit struct {
+	value byte
+	edge  Edge
+}
+
+// edgeBefore reports whether edge a occurred before edge b. Sequence numbers
+// are exact when both edges have one from the same sequence; otherwise their
+// timestamps are used.
+func edgeBefore(a, b Edge) bool {
+	if a.Seq != 0 && b.Seq != 0 && a.SeqGroup != 0 && a.SeqGroup == b.SeqGroup {
+		return a.Seq < b.Seq
+	}
+	return a.Time.Before(b.Time)
+}
+
+// sortBits returns a copy of rx in the order their edges occurred on the wire.
+func sortBits(rx []rxBit) []rxBit {
+	sorted := append([]rxBit(nil), rx...)
+	sort.SliceStable(sorted, func(i, j int) bool { return edgeBefore(sorted[i].edge, sorted[j].edge) })
+	return sorted
+}
+
+// frameBits returns the values of rx in the order their edges occurred on the
+// wire. D0 and D1 are watched by separate goroutines, so the order bits were
+// appended in depends on the scheduler rather than the wire.
+func frameBits(rx []rxBit) []byte {
+	sorted := sortBits(rx)
+	bits := make([]byte, len(sorted))
+	for i, b := range sorted {
+		bits[i] = b.value
+	}
+	return bits
+}
+
+// watchPin monitors an edge source and sends bits to the data buffer.
+func (r *Reader) watchPin(src EdgeSource, bit byte) {
+	defer r.wg.Done()
 	for {
 		select {
 		case <-r.ctx.Done():
 			return
 		default:
-			if pin.WaitForEdge(1*time.Second) { // trust the kernel-latched falling edge; re-reading the pin here raced the ~50us Wiegand pulse and dropped bits (esp. the first edge after idle)
-				r.mu.Lock()
-				r.data = append(r.data, bit)
-				r.lastBitTime = time.Now()
-				select {
-				case r.pulse <- true:
-				default:
+			edge, ok, err := src.WaitForEdge(1 * time.Second)
+			if err != nil {
+				if r.ctx.Err() == nil {
+					r.emit(Event{Time: time.Now(), Err: &LineError{Reader: r.name, Line: int(bit), Err: err}})
 				}
-				r.mu.Unlock()
+				return
+			}
+			if ok {
+				r.handleEdge(bit, edge)
 			}
 		}
 	}
 }
 
+// handleEdge passes a received edge through the glitch filter and appends
+// any resulting bit to the data buffer, enforcing maxBits and watching for
+// stuck lines.
+func (r *Reader) handleEdge(bit byte, edge Edge) {
+	r.mu.Lock()
+	errs, frame := r.addEdge(bit, edge)
+	r.mu.Unlock()
+	for _, err := range errs {
+		r.emit(Event{Time: edge.Time, Err: err})
+	}
+	if len(frame) > 0 {
+		r.decodeFrame(frameBits(frame), frame[len(frame)-1].edge.Time)
+	}
+}
+
+// addEdge does the work of handleEdge with r.mu held, returning the errors
+// to report and any frame split off by OverflowSplit.
+func (r *Reader) addEdge(bit byte, edge Edge) (errs []error, frame []rxBit) {
+	r.stats.Edges++
+	if edge.Time.After(r.lastBitTime) {
+		r.lastBitTime = edge.Time
+	}
+	select {
+	case r.pulse <- true:
+	default:
+	}
+
+	if r.burstStart.IsZero() {
+		r.burstStart = edge.Time
+	}
+	r.burstEdges[bit]++
+	if burst := edge.Time.Sub(r.burstStart); r.stuckTimeout > 0 && burst > r.stuckTimeout && !r.stuckReported {
+		r.stuckReported = true
+		line := 0
+		if r.burstEdges[1] > r.burstEdges[0] {
+			line = 1
+		}
+		errs = append(errs, &StuckLineError{Reader: r.name, Line: line, Edges: r.burstEdges, Duration: burst})
+	}
+
+	edge, ok := r.filter.accept(bit, edge, &r.stats)
+	if !ok || r.discarding {
+		return errs, nil
+	}
+	r.data = append(r.data, rxBit{value: bit, edge: edge})
+	if len(r.data) <= r.maxBits {
+		return errs, nil
+	}
+
+	sorted := sortBits(r.data)
+	errs = append(errs, &OverflowError{Reader: r.name, MaxBits: r.maxBits, Bits: frameBits(sorted), Policy: r.overflow})
+	switch r.overflow {
+	case OverflowSplit:
+		split := longestGap(sorted)
+		frame = r.filter.spaced(sorted[:split], &r.stats)
+		r.data = append(r.data[:0], sorted[split:]...)
+	default:
+		r.data = r.data[:0]
+		r.discarding = true
+	}
+	return errs, frame
+}
+
+// longestGap returns the index of the bit which follows the longest gap
+// between consecutive edges in rx, which must be sorted and hold at least
+// two bits.
+func longestGap(rx []rxBit) int {
+	split := 1
+	var longest time.Duration
+	for i := 1; i < len(rx); i++ {
+		if gap := rx[i].edge.Time.Sub(rx[i-1].edge.Time); gap > longest {
+			longest, split = gap, i
+		}
+	}
+	return split
+}
+
 // checkParity calculates even or odd parity for a range of bits in the data.
 func checkParity(bits []byte, start, length int, even bool) bool {
 	if start+length > len(bits) {
@@ -165,114 +500,224 @@ func checkParity(bits []byte, start, length int, even bool) bool {
 //	}
 //	fmt.Println(site, tag) // Outputs site code and tag value, e.g., "1" and "21845"
 func decodeBits(bits []byte, siteCodeStart, siteCodeLength, tagStart, tagLength int) (string, string, error) {
+	site := Field{Start: siteCodeStart, Length: siteCodeLength}
+	tag := Field{Start: tagStart, Length: tagLength}
+	siteCode, tagValue, err := decodeFields(bits, site, tag)
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("%d", siteCode), fmt.Sprintf("%d", tagValue), nil
+}
+
+// decodeFields is the numeric form of decodeBits, accumulating the site and
+// tag fields of bits as unsigned integers.
+func decodeFields(bits []byte, site, tag Field) (uint64, uint64, error) {
 	// Validate input length against site code and tag requirements.
-	if len(bits) < tagStart+tagLength {
-		return "", "", fmt.Errorf("input slice too short: need at least %d bits for tag start and length, got %d", tagStart+tagLength, len(bits))
+	if len(bits) < tag.Start+tag.Length {
+		return 0, 0, fmt.Errorf("input slice too short: need at least %d bits for tag start and length, got %d", tag.Start+tag.Length, len(bits))
 	}
-	if siteCodeStart+siteCodeLength > len(bits) {
-		return "", "", fmt.Errorf("site code range (%d to %d) exceeds input length %d", siteCodeStart, siteCodeStart+siteCodeLength-1, len(bits))
+	if site.Start+site.Length > len(bits) {
+		return 0, 0, fmt.Errorf("site code range (%d to %d) exceeds input length %d", site.Start, site.Start+site.Length-1, len(bits))
 	}
 
 	// Validate bit values.
 	for _, bit := range bits {
 		if bit != 0 && bit != 1 {
-			return "", "", fmt.Errorf("invalid bit value: %d, expected 0 or 1", bit)
+			return 0, 0, fmt.Errorf("invalid bit value: %d, expected 0 or 1", bit)
 		}
 	}
 
 	var siteCode, tagValue uint64
 
 	// Accumulate site code from the specified range.
-	for i := 0; i < siteCodeLength; i++ {
-		bitIndex := siteCodeStart + i
+	for i := 0; i < site.Length; i++ {
+		bitIndex := site.Start + i
 		siteCode = (siteCode << 1) | uint64(bits[bitIndex])
 	}
 
 	// Accumulate tag value from the specified range.
-	for i := 0; i < tagLength; i++ {
-		bitIndex := tagStart + i
+	for i := 0; i < tag.Length; i++ {
+		bitIndex := tag.Start + i
 		tagValue = (tagValue << 1) | uint64(bits[bitIndex])
 	}
 
-	return fmt.Sprintf("%d", siteCode), fmt.Sprintf("%d", tagValue), nil
+	return siteCode, tagValue, nil
+}
+
+// untilFrameEnd returns how much longer to wait for further bits before the
+// current frame is considered complete.
+func (r *Reader) untilFrameEnd() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.timeout - time.Since(r.lastBitTime)
 }
 
 // processData collects Wiegand bits, detects complete frames, and invokes the callback.
 func (r *Reader) processData() {
+	defer r.wg.Done()
 	for {
 		select {
 		case <-r.ctx.Done():
 			return
 		case <-r.pulse:
 			// Wait until timeout elapses since last bit
-			for time.Since(r.lastBitTime) < r.timeout {
+			for remaining := r.untilFrameEnd(); remaining > 0; remaining = r.untilFrameEnd() {
 				select {
 				case <-r.pulse:
 					// New pulse received, reset timeout
 				case <-r.ctx.Done():
 					return
-				case <-time.After(r.timeout - time.Since(r.lastBitTime)):
+				case <-time.After(remaining):
 					// Timeout elapsed, process data
 				}
 			}
 			r.mu.Lock()
-			data := make([]byte, len(r.data)) // Copy data
-			copy(data, r.data)
+			data := frameBits(r.filter.spaced(sortBits(r.data), &r.stats))
 			r.data = r.data[:0] // Reset buffer
+			frameTime := r.lastBitTime
+			r.discarding = false
+			r.burstStart = time.Time{}
+			r.burstEdges = [2]int{}
+			r.stuckReported = false
 			r.mu.Unlock()
 
-			if len(data) == 0 {
-				continue
-			}
+			r.decodeFrame(data, frameTime)
+		}
+	}
+}
 
-			fmt.Printf("Received %d-bit value: %v\n", len(data), data)
+// decodeFrame decodes a complete frame and delivers the result to the
+// callbacks.
+func (r *Reader) decodeFrame(data []byte, frameTime time.Time) {
+	if len(data) == 0 {
+		return
+	}
 
-			switch len(data) {
-			case 26:
-				site, tag, err := decodeBits(data, 1, 8, 9, 16)
-				if err != nil {
-					go r.errorCallback(fmt.Sprintf("bug in calling decodeBits for 26b tag: %v", err))
-					continue
-				}
-				if !checkParity(data, 0, 13, true) || !checkParity(data, 13, 13, false) {
-					go r.errorCallback(fmt.Sprintf("Invalid parity for 26-bit tag: %s (%s)", tag, site))
-					continue
-				}
-				fmt.Printf("Received 26-bit tag: %s (%s)\n", tag, site)
-				go r.callback(site, tag)
-			case 34:
-				site, tag, err := decodeBits(data, 1, 17, 18, 16)
-				if err != nil {
-					go r.errorCallback(fmt.Sprintf("bug in calling decodeBits for 34b tag: %v", err))
-					continue
-				}
-				if !checkParity(data, 0, 17, true) || !checkParity(data, 17, 17, false) {
-					go r.errorCallback(fmt.Sprintf("Invalid parity for 34-bit tag: %s (%s)", tag, site))
-					continue
-				}
-				fmt.Printf("Received 34-bit tag: %s (%s)\n", tag, site)
-				go r.callback(site, tag)
-			case 37:
-				site, tag, err := decodeBits(data, 1, 19, 20, 16)
-				if err != nil {
-					go r.errorCallback(fmt.Sprintf("bug in calling decodeBits for 37b tag: %v", err))
-					continue
-				}
-				if !checkParity(data, 0, 19, true) || !checkParity(data, 19, 18, false) {
-					go r.errorCallback(fmt.Sprintf("Invalid parity for 37-bit tag: %s (%s)", tag, site))
-					continue
-				}
-				fmt.Printf("Received 37-bit tag: %s (%s)\n", tag, site)
-				go r.callback(site, tag)
-			default:
-				go r.errorCallback(fmt.Sprintf("Received unknown %d-bit value", len(data)))
-			}
+	if r.logCredentials {
+		r.logger.Debug("frame received", "bits", len(data), "value", data)
+	} else {
+		r.logger.Debug("frame received", "bits", len(data))
+	}
+
+	if r.keypad != nil && (len(data) == 4 || len(data) == 8) {
+		key, kerr := decodeKey(data)
+		if kerr != nil {
+			kerr.Reader = r.name
+			r.emit(Event{Time: frameTime, Err: kerr})
+			return
+		}
+		r.keypad.press(Key{Reader: r.name, Key: key, Time: frameTime})
+		return
+	}
+
+	format, ok := r.formats.Lookup(len(data))
+	if !ok {
+		r.emit(Event{Time: frameTime, Err: &UnknownLengthError{Reader: r.name, Bits: data}})
+		return
+	}
+	site, tag, err := decodeFields(data, format.Site, format.Tag)
+	if err != nil {
+		r.emit(Event{Time: frameTime, Err: fmt.Errorf("bug in calling decodeBits for %s tag: %w", format.Name, err)})
+		return
+	}
+	if failed := format.failedParity(data); len(failed) > 0 {
+		r.emit(Event{Time: frameTime, Err: &ParityError{
+			Reader: r.name,
+			Format: format.Name,
+			Bits:   data,
+			Site:   site,
+			Tag:    tag,
+			Failed: failed,
+		}})
+		return
+	}
+	c := Credential{
+		Reader: r.name,
+		Format: format.Name,
+		Bits:   data,
+		Site:   site,
+		Tag:    tag,
+		Time:   frameTime,
+	}
+	if r.duplicate(c) {
+		if r.duplicates == DuplicateDrop {
+			r.logger.Debug("duplicate credential dropped", r.credentialAttrs(c)...)
+			return
 		}
+		c.Duplicate = true
+	}
+	r.logger.Info("credential read", r.credentialAttrs(c)...)
+	r.emit(Event{Time: frameTime, Credential: &c})
+}
+
+// duplicate reports whether c repeats the previous credential within the
+// DuplicateWindow, and records c as the previous credential.
+func (r *Reader) duplicate(c Credential) bool {
+	if r.dupWindow <= 0 {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev := r.lastCred
+	r.lastCred = c
+	if prev.Format != c.Format || prev.Site != c.Site || prev.Tag != c.Tag || c.Time.Sub(prev.Time) >= r.dupWindow {
+		return false
 	}
+	r.stats.Duplicates++
+	return true
+}
+
+// Stats returns the Reader's activity counters.
+func (r *Reader) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// Formats returns the formats the Reader decodes, the built-in formats and
+// Config.Formats, ordered by bit length.
+func (r *Reader) Formats() []Format {
+	return r.formats.Formats()
 }
 
-// Close stops the Wiegand reader and releases resources.
+// Feedback returns the driver for the reader's LED and beeper, e.g. to play
+// PatternGrant after an access decision. It returns nil, whose methods do
+// nothing, if Config.Feedback configures neither output. Close turns both
+// off.
+func (r *Reader) Feedback() *Feedback {
+	return r.feedback
+}
+
+// Close stops the Wiegand reader and releases its pins. It waits for the
+// goroutines reading the pins to exit, so the pins can be opened again as
+// soon as it returns. A frame still being received is discarded or decoded
+// according to Config.OnClose, then the event channel is closed. Callbacks
+// may still be running for events delivered before Close returned.
+//
+// Close returns the errors from closing the pins. It is safe to call more
+// than once, and is called automatically when the Reader's context is
+// cancelled.
 func (r *Reader) Close() error {
-	r.cancel()
-	return nil
+	r.closeOnce.Do(func() {
+		r.cancel()
+		r.closeErr = errors.Join(r.d0.Close(), r.d1.Close())
+		r.wg.Wait()
+
+		r.mu.Lock()
+		var rx []rxBit
+		if r.onClose == CloseFlush && !r.discarding {
+			rx = r.filter.spaced(sortBits(r.data), &r.stats)
+		}
+		r.data = r.data[:0]
+		r.mu.Unlock()
+		if len(rx) > 0 {
+			r.decodeFrame(frameBits(rx), rx[len(rx)-1].edge.Time)
+		}
+		if r.keypad != nil {
+			r.keypad.stop()
+		}
+		r.feedback.close()
+		r.closeEvents()
+	})
+	return r.closeErr
 }
@@ -2,10 +2,51 @@ package wiegand
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
+
+	"periph.io/x/conn/v3/gpio"
 )
 
+// fakeBackend is a Backend of named fakeSources.
+type fakeBackend map[string]*fakeSource
+
+func (b fakeBackend) Open(name string, edge gpio.Edge) (EdgeSource, error) {
+	s, ok := b[name]
+	if !ok {
+		return nil, ErrUnknownLine
+	}
+	return s, nil
+}
+
+// fakeSource is an EdgeSource which delivers edges sent on a channel.
+type fakeSource struct {
+	edges  chan Edge
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{edges: make(chan Edge), closed: make(chan struct{})}
+}
+
+func (s *fakeSource) WaitForEdge(timeout time.Duration) (Edge, bool, error) {
+	select {
+	case e := <-s.edges:
+		return e, true, nil
+	case <-s.closed:
+		return Edge{}, false, ErrClosed
+	case <-time.After(timeout):
+		return Edge{}, false, nil
+	}
+}
+
+func (s *fakeSource) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
 func TestNewReader(t *testing.T) {
 	// Mock callback
 	callback := func(site, tag string) {
@@ -35,6 +76,76 @@ func TestNewReader(t *testing.T) {
 	}
 }
 
+func TestReaderFakeBackend(t *testing.T) {
+	d0, d1 := newFakeSource(), newFakeSource()
+	got := make(chan Credential, 1)
+	reader, err := New(context.Background(), Config{
+		Name:               "test",
+		D0Pin:              "D0",
+		D1Pin:              "D1",
+		Backend:            fakeBackend{"D0": d0, "D1": d1},
+		CredentialCallback: func(c Credential) { got <- c },
+		Timeout:            20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer reader.Close()
+
+	bits, err := Format26.Encode(15, 54321)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	for _, bit := range bits {
+		src := d0
+		if bit == 1 {
+			src = d1
+		}
+		src.edges <- Edge{Time: time.Now()}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case c := <-got:
+		if c.Reader != "test" || c.Format != "26-bit" || c.Site != 15 || c.Tag != 54321 {
+			t.Errorf("got credential %+v, want test 26-bit 15:54321", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for credential")
+	}
+}
+
+func TestFrameBitsOrder(t *testing.T) {
+	t0 := time.Now()
+	// Kernel sequence numbers take precedence over timestamps, which may
+	// be equal or skewed between lines.
+	rx := []rxBit{
+		{value: 1, edge: Edge{Time: t0, Seq: 3, SeqGroup: 1}},
+		{value: 0, edge: Edge{Time: t0, Seq: 1, SeqGroup: 1}},
+		{value: 1, edge: Edge{Time: t0.Add(-time.Millisecond), Seq: 2, SeqGroup: 1}},
+	}
+	if got, want := frameBits(rx), []byte{0, 1, 1}; string(got) != string(want) {
+		t.Errorf("frameBits() by sequence = %v, want %v", got, want)
+	}
+	// Sequence numbers of separate line requests are unrelated.
+	rx = []rxBit{
+		{value: 1, edge: Edge{Time: t0.Add(time.Millisecond), Seq: 1, SeqGroup: 2}},
+		{value: 0, edge: Edge{Time: t0, Seq: 2, SeqGroup: 3}},
+	}
+	if got, want := frameBits(rx), []byte{0, 1}; string(got) != string(want) {
+		t.Errorf("frameBits() across requests = %v, want %v", got, want)
+	}
+	rx = []rxBit{
+		{value: 1, edge: Edge{Time: t0.Add(2 * time.Millisecond)}},
+		{value: 0, edge: Edge{Time: t0}},
+		{value: 1, edge: Edge{Time: t0.Add(time.Millisecond)}},
+		{value: 0, edge: Edge{Time: t0.Add(3 * time.Millisecond)}},
+	}
+	if got, want := frameBits(rx), []byte{0, 1, 1, 0}; string(got) != string(want) {
+		t.Errorf("frameBits() by time = %v, want %v", got, want)
+	}
+}
+
 func TestDecodeBits(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -0,0 +1,342 @@
+// Package wiegandtest provides a simulated Wiegand line for testing code
+// built on package wiegand without GPIO hardware.
+package wiegandtest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+// DefaultPulseWidth is the default width of a simulated data pulse.
+const DefaultPulseWidth = 50 * time.Microsecond
+
+// DefaultInterval is the default time between the starts of consecutive
+// simulated data pulses.
+const DefaultInterval = 2 * time.Millisecond
+
+// GlitchWidth is the width of the noise spikes injected by Noise.
+const GlitchWidth = 500 * time.Nanosecond
+
+// Line simulates the D0 and D1 wires between a Wiegand reader and a Reader.
+// It implements wiegand.Backend for the line names "D0" and "D1"; each call
+// to Open replaces any previously opened source for that line.
+type Line struct {
+	PulseWidth time.Duration // Width of each data pulse (default DefaultPulseWidth)
+	Interval   time.Duration // Time between pulse starts (default DefaultInterval)
+	// Latency delays the delivery of edges on D0 (index 0) and D1 (index 1)
+	// to their sources, without changing the edges' timestamps. It models
+	// interrupt and scheduling delays which differ between the two lines.
+	Latency [2]time.Duration
+
+	mu      sync.Mutex
+	sources [2]*source // Currently open sources for D0 and D1
+}
+
+// NewLine returns a Line using the default pulse width and interval.
+func NewLine() *Line {
+	return &Line{PulseWidth: DefaultPulseWidth, Interval: DefaultInterval}
+}
+
+// Open returns an edge source for "D0" or "D1".
+func (l *Line) Open(name string, edge gpio.Edge) (wiegand.EdgeSource, error) {
+	var bit int
+	switch name {
+	case "D0":
+		bit = 0
+	case "D1":
+		bit = 1
+	default:
+		return nil, fmt.Errorf("%w: %s", wiegand.ErrUnknownLine, name)
+	}
+	s := &source{edge: edge, edges: make(chan wiegand.Edge), closed: make(chan struct{}), failed: make(chan struct{})}
+	l.mu.Lock()
+	l.sources[bit] = s
+	l.mu.Unlock()
+	return s, nil
+}
+
+// ReportsEdgeDirection returns true: the simulated sources report the
+// direction of each edge.
+func (l *Line) ReportsEdgeDirection() bool { return true }
+
+// Fail makes the sources currently open on the line return err from
+// WaitForEdge, as if the hardware had failed. Sources opened afterwards work
+// normally.
+func (l *Line) Fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range l.sources {
+		if s != nil {
+			s.fail(err)
+		}
+	}
+}
+
+// Lines is a wiegand.Backend for several simulated Lines, such as the
+// readers of a wiegand.Manager. It opens line names of the form "name/D0"
+// and "name/D1" on the Line with that name.
+type Lines map[string]*Line
+
+// Open returns an edge source for "name/D0" or "name/D1".
+func (ls Lines) Open(name string, edge gpio.Edge) (wiegand.EdgeSource, error) {
+	line, wire, _ := strings.Cut(name, "/")
+	l, ok := ls[line]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", wiegand.ErrUnknownLine, name)
+	}
+	return l.Open(wire, edge)
+}
+
+// ReportsEdgeDirection returns true, as Line does.
+func (ls Lines) ReportsEdgeDirection() bool { return true }
+
+// Fault alters a frame as it is transmitted by SendWith. It receives the
+// frame's pulses in order and returns the pulses to transmit, which may be
+// modified in place; SendWith sorts them by Start.
+type Fault func(pulses []Pulse) []Pulse
+
+// Pulse is a single low-going pulse on D0 or D1.
+type Pulse struct {
+	Bit   byte          // 0 for D0, 1 for D1
+	Start time.Duration // Offset of the falling edge from the start of the frame
+	Width time.Duration // Time until the rising edge
+}
+
+// DropBit removes bit i from the frame, as if the pulse was never seen.
+func DropBit(i int) Fault {
+	return func(pulses []Pulse) []Pulse {
+		if i < 0 || i >= len(pulses) {
+			return pulses
+		}
+		return append(pulses[:i:i], pulses[i+1:]...)
+	}
+}
+
+// ExtraBit inserts a full-width pulse for bit after bit i, spaced half an
+// interval after it.
+func ExtraBit(i int, bit byte) Fault {
+	return func(pulses []Pulse) []Pulse {
+		return insertAfter(pulses, i, bit, 0.5, 0)
+	}
+}
+
+// Noise injects a GlitchWidth spike on the D0 (bit 0) or D1 (bit 1) line a
+// tenth of an interval after bit i.
+func Noise(i int, bit byte) Fault {
+	return func(pulses []Pulse) []Pulse {
+		return insertAfter(pulses, i, bit, 0.1, GlitchWidth)
+	}
+}
+
+// Pause delays every pulse after bit i by d, leaving a longer gap in the
+// frame.
+func Pause(i int, d time.Duration) Fault {
+	return func(pulses []Pulse) []Pulse {
+		for j := i + 1; j < len(pulses); j++ {
+			pulses[j].Start += d
+		}
+		return pulses
+	}
+}
+
+// insertAfter inserts a pulse frac of the way from bit i to the next bit. A
+// zero width means the width of the neighbouring pulse.
+func insertAfter(pulses []Pulse, i int, bit byte, frac float64, width time.Duration) []Pulse {
+	if i < 0 || i >= len(pulses) {
+		return pulses
+	}
+	gap := time.Millisecond
+	if i+1 < len(pulses) {
+		gap = pulses[i+1].Start - pulses[i].Start
+	}
+	if width == 0 {
+		width = pulses[i].Width
+	}
+	p := Pulse{Bit: bit, Start: pulses[i].Start + time.Duration(float64(gap)*frac), Width: width}
+	out := append([]Pulse(nil), pulses[:i+1]...)
+	out = append(out, p)
+	return append(out, pulses[i+1:]...)
+}
+
+// Send transmits bits on the line, returning once the last pulse has been
+// delivered.
+func (l *Line) Send(bits []byte) error {
+	return l.SendWith(bits)
+}
+
+// SendFrame encodes site and tag in format f and transmits the frame.
+func (l *Line) SendFrame(f wiegand.Format, site, tag uint64) error {
+	bits, err := f.Encode(site, tag)
+	if err != nil {
+		return err
+	}
+	return l.Send(bits)
+}
+
+// SendWith transmits bits on the line after applying faults in order.
+func (l *Line) SendWith(bits []byte, faults ...Fault) error {
+	width, interval := l.PulseWidth, l.Interval
+	if width <= 0 {
+		width = DefaultPulseWidth
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	pulses := make([]Pulse, len(bits))
+	for i, b := range bits {
+		if b != 0 && b != 1 {
+			return fmt.Errorf("invalid bit value %d at index %d", b, i)
+		}
+		pulses[i] = Pulse{Bit: b, Start: time.Duration(i) * interval, Width: width}
+	}
+	for _, f := range faults {
+		pulses = f(pulses)
+	}
+	sort.SliceStable(pulses, func(i, j int) bool { return pulses[i].Start < pulses[j].Start })
+
+	// Each edge is stamped with the time it occurs on the wire and handed
+	// to its source Latency later, in order of delivery time.
+	type delivery struct {
+		at   time.Time
+		bit  byte
+		edge wiegand.Edge
+	}
+	start := time.Now()
+	deliveries := make([]delivery, 0, 2*len(pulses))
+	for _, p := range pulses {
+		fall, rise := start.Add(p.Start), start.Add(p.Start+p.Width)
+		deliveries = append(deliveries,
+			delivery{at: fall.Add(l.Latency[p.Bit]), bit: p.Bit, edge: wiegand.Edge{Time: fall}},
+			delivery{at: rise.Add(l.Latency[p.Bit]), bit: p.Bit, edge: wiegand.Edge{Time: rise, Rising: true}})
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool { return deliveries[i].at.Before(deliveries[j].at) })
+	for _, d := range deliveries {
+		time.Sleep(time.Until(d.at))
+		if err := l.deliver(d.bit, d.edge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeliveryTimeout bounds how long the Line waits for an open source to
+// accept an edge before giving up on the transmission.
+const DeliveryTimeout = time.Second
+
+// errNotConsumed is returned when an open source is not being read.
+var errNotConsumed = errors.New("edge not consumed")
+
+// deliver hands an edge to the source for bit, if one is open for edges of
+// its direction, and waits for it to be received. Handing edges over one at
+// a time mirrors a physical wire, where each edge is latched before the next
+// one arrives.
+func (l *Line) deliver(bit byte, e wiegand.Edge) error {
+	l.mu.Lock()
+	s := l.sources[bit]
+	l.mu.Unlock()
+	if s == nil || !s.detects(e) {
+		return nil
+	}
+	timer := time.NewTimer(DeliveryTimeout)
+	defer timer.Stop()
+	select {
+	case s.edges <- e:
+		return nil
+	case <-s.closed:
+		return nil
+	case <-s.failed:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("D%d: %w", bit, errNotConsumed)
+	}
+}
+
+// Outputs returns output pins driving the D0 and D1 wires, so a
+// wiegand.Writer can transmit to Readers on this Line. Each transition
+// delivers an edge; the wires idle high.
+func (l *Line) Outputs() (d0, d1 wiegand.OutputPin) {
+	return &output{line: l, bit: 0, level: gpio.High}, &output{line: l, bit: 1, level: gpio.High}
+}
+
+// output is a wiegand.OutputPin driving one simulated wire.
+type output struct {
+	line  *Line
+	bit   byte
+	mu    sync.Mutex
+	level gpio.Level
+}
+
+func (o *output) Out(l gpio.Level) error {
+	o.mu.Lock()
+	changed := o.level != l
+	o.level = l
+	o.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return o.line.deliver(o.bit, wiegand.Edge{Time: time.Now(), Rising: l == gpio.High})
+}
+
+// source is the wiegand.EdgeSource for one simulated wire.
+type source struct {
+	edge   gpio.Edge // Edges the source was opened to detect
+	edges  chan wiegand.Edge
+	closed chan struct{}
+	once   sync.Once
+	failed chan struct{} // Closed by fail, after err is set
+	err    error
+	fonce  sync.Once
+}
+
+// fail makes WaitForEdge return err.
+func (s *source) fail(err error) {
+	s.fonce.Do(func() {
+		s.err = err
+		close(s.failed)
+	})
+}
+
+// detects reports whether the source was opened for edges like e.
+func (s *source) detects(e wiegand.Edge) bool {
+	switch s.edge {
+	case gpio.BothEdges:
+		return true
+	case gpio.RisingEdge:
+		return e.Rising
+	default:
+		return !e.Rising
+	}
+}
+
+func (s *source) WaitForEdge(timeout time.Duration) (wiegand.Edge, bool, error) {
+	select {
+	case <-s.closed:
+		return wiegand.Edge{}, false, wiegand.ErrClosed
+	default:
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case e := <-s.edges:
+		return e, true, nil
+	case <-s.closed:
+		return wiegand.Edge{}, false, wiegand.ErrClosed
+	case <-s.failed:
+		return wiegand.Edge{}, false, s.err
+	case <-timer.C:
+		return wiegand.Edge{}, false, nil
+	}
+}
+
+func (s *source) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
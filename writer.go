@@ -0,0 +1,174 @@
+package wiegand
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// OutputPin is a line that can be driven high or low. Every periph gpio.PinOut
+// satisfies it.
+type OutputPin interface {
+	Out(l gpio.Level) error
+}
+
+// releaseOutput releases an output opened by OpenOutput, if the pin supports
+// it: periph pins are halted, and pins implementing io.Closer are closed.
+func releaseOutput(p OutputPin) error {
+	switch p := p.(type) {
+	case io.Closer:
+		return p.Close()
+	case interface{ Halt() error }:
+		return p.Halt()
+	}
+	return nil
+}
+
+// DefaultPulseWidth is the default width of a transmitted data pulse.
+const DefaultPulseWidth = 50 * time.Microsecond
+
+// DefaultPulseInterval is the default time between the starts of consecutive
+// transmitted data pulses.
+const DefaultPulseInterval = 2 * time.Millisecond
+
+// WriterConfig holds configuration for creating a new Wiegand Writer.
+type WriterConfig struct {
+	D0Pin, D1Pin string    // GPIO pin names, each opened with PeriphBackend if D0 or D1 is nil
+	D0, D1       OutputPin // Already opened output pins (optional)
+	// Invert drives the lines high for a pulse and low when idle, for
+	// outputs wired through an inverting stage. By default lines idle high
+	// and are pulled low for each bit, as on the Wiegand wire.
+	Invert     bool
+	PulseWidth time.Duration // Width of each pulse (default 50us)
+	Interval   time.Duration // Time between pulse starts (default 2ms)
+	// Formats are additional frame layouts for WriteCredential, on top of
+	// the built-in formats.
+	Formats []Format
+}
+
+// Writer transmits Wiegand frames on a pair of output lines.
+type Writer struct {
+	d0, d1     OutputPin  // Outputs for Wiegand D0 and D1
+	idle       gpio.Level // Level of a line between pulses
+	pulseWidth time.Duration
+	interval   time.Duration
+	formats    *Registry   // Known frame layouts, looked up by name
+	opened     []OutputPin // Outputs opened by NewWriter, released by Close
+	mu         sync.Mutex  // Serializes frames so they never interleave
+}
+
+// NewWriter creates a Writer and drives both lines to their idle level.
+func NewWriter(cfg WriterConfig) (*Writer, error) {
+	if cfg.PulseWidth <= 0 {
+		cfg.PulseWidth = DefaultPulseWidth
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultPulseInterval
+	}
+	if cfg.PulseWidth >= cfg.Interval {
+		return nil, fmt.Errorf("pulse width %v must be shorter than interval %v", cfg.PulseWidth, cfg.Interval)
+	}
+	formats, err := NewRegistry(cfg.Formats...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format: %w", err)
+	}
+
+	w := &Writer{
+		d0:         cfg.D0,
+		d1:         cfg.D1,
+		idle:       gpio.High,
+		pulseWidth: cfg.PulseWidth,
+		interval:   cfg.Interval,
+		formats:    formats,
+	}
+	if cfg.Invert {
+		w.idle = gpio.Low
+	}
+	if (w.d0 == nil && cfg.D0Pin == "") || (w.d1 == nil && cfg.D1Pin == "") {
+		return nil, errors.New("D0Pin and D1Pin must be specified")
+	}
+	if w.d0 == nil {
+		if w.d0, err = (PeriphBackend{}).OpenOutput(cfg.D0Pin, w.idle); err != nil {
+			return nil, fmt.Errorf("failed to configure D0 pin %s: %w", cfg.D0Pin, err)
+		}
+		w.opened = append(w.opened, w.d0)
+	}
+	if w.d1 == nil {
+		if w.d1, err = (PeriphBackend{}).OpenOutput(cfg.D1Pin, w.idle); err != nil {
+			w.Close()
+			return nil, fmt.Errorf("failed to configure D1 pin %s: %w", cfg.D1Pin, err)
+		}
+		w.opened = append(w.opened, w.d1)
+	}
+	if err := w.d0.Out(w.idle); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to idle D0: %w", err)
+	}
+	if err := w.d1.Out(w.idle); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to idle D1: %w", err)
+	}
+	return w, nil
+}
+
+// Close waits for any frame in progress and releases the output pins opened
+// by NewWriter. Pins passed in WriterConfig.D0 and D1 are left to the caller.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var errs []error
+	for _, p := range w.opened {
+		errs = append(errs, releaseOutput(p))
+	}
+	w.opened = nil
+	return errors.Join(errs...)
+}
+
+// WriteCredential encodes c.Site and c.Tag in the format named by c.Format,
+// computing fresh parity bits, and transmits the frame. c.Bits is ignored.
+func (w *Writer) WriteCredential(c Credential) error {
+	f, ok := w.formats.ByName(c.Format)
+	if !ok {
+		return fmt.Errorf("unknown format %q", c.Format)
+	}
+	bits, err := f.Encode(c.Site, c.Tag)
+	if err != nil {
+		return err
+	}
+	return w.WriteBits(bits)
+}
+
+// WriteBits transmits bits exactly as given, one pulse per bit on D0 for a 0
+// or D1 for a 1. It blocks until the frame has been sent.
+func (w *Writer) WriteBits(bits []byte) error {
+	for i, bit := range bits {
+		if bit != 0 && bit != 1 {
+			return fmt.Errorf("invalid bit value %d at index %d", bit, i)
+		}
+	}
+	active := !w.idle
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	next := time.Now()
+	for _, bit := range bits {
+		pin := w.d0
+		if bit == 1 {
+			pin = w.d1
+		}
+		time.Sleep(time.Until(next))
+		next = time.Now().Add(w.interval)
+		if err := pin.Out(active); err != nil {
+			return fmt.Errorf("failed to pulse D%d: %w", bit, err)
+		}
+		time.Sleep(w.pulseWidth)
+		if err := pin.Out(w.idle); err != nil {
+			return fmt.Errorf("failed to release D%d: %w", bit, err)
+		}
+	}
+	return nil
+}
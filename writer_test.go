@@ -0,0 +1,105 @@
+package wiegand_test
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+
+	"github.com/asjoyner/wiegand-go"
+)
+
+// recordingPin is an OutputPin which records every level it is driven to.
+type recordingPin struct {
+	mu     sync.Mutex
+	levels []gpio.Level
+}
+
+func (p *recordingPin) Out(l gpio.Level) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.levels = append(p.levels, l)
+	return nil
+}
+
+func TestWriterLevels(t *testing.T) {
+	d0, d1 := &recordingPin{}, &recordingPin{}
+	w, err := wiegand.NewWriter(wiegand.WriterConfig{
+		D0:         d0,
+		D1:         d1,
+		Invert:     true,
+		PulseWidth: 10 * time.Microsecond,
+		Interval:   100 * time.Microsecond,
+	})
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	if err := w.WriteBits([]byte{0, 1, 1}); err != nil {
+		t.Fatalf("WriteBits() error = %v", err)
+	}
+	// Inverted lines idle low and go high for each pulse.
+	wantD0 := []gpio.Level{gpio.Low, gpio.High, gpio.Low}
+	wantD1 := []gpio.Level{gpio.Low, gpio.High, gpio.Low, gpio.High, gpio.Low}
+	if !slices.Equal(d0.levels, wantD0) {
+		t.Errorf("D0 levels = %v, want %v", d0.levels, wantD0)
+	}
+	if !slices.Equal(d1.levels, wantD1) {
+		t.Errorf("D1 levels = %v, want %v", d1.levels, wantD1)
+	}
+	if err := w.WriteBits([]byte{0, 2}); err == nil {
+		t.Error("WriteBits() with invalid bit succeeded, want error")
+	}
+}
+
+func TestWriterLoopback(t *testing.T) {
+	s := newSimReader(t, wiegand.Config{Name: "panel"})
+	d0, d1 := s.line.Outputs()
+	w, err := wiegand.NewWriter(wiegand.WriterConfig{D0: d0, D1: d1, Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	in := wiegand.Credential{Format: "37-bit", Site: 12345, Tag: 999}
+	if err := w.WriteCredential(in); err != nil {
+		t.Fatalf("WriteCredential() error = %v", err)
+	}
+	if c := s.credential(t); c.Format != in.Format || c.Site != in.Site || c.Tag != in.Tag {
+		t.Errorf("got %v, want %v", c, in)
+	}
+
+	if err := w.WriteCredential(wiegand.Credential{Format: "99-bit"}); err == nil {
+		t.Error("WriteCredential() with unknown format succeeded, want error")
+	}
+}
+
+// closingPin is an OutputPin recording whether it was closed.
+type closingPin struct {
+	recordingPin
+	closed bool
+}
+
+func (p *closingPin) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestWriterPins(t *testing.T) {
+	d0 := &closingPin{}
+	if _, err := wiegand.NewWriter(wiegand.WriterConfig{D0: d0}); err == nil {
+		t.Error("NewWriter() without D1 or D1Pin succeeded, want error")
+	}
+
+	d1 := &closingPin{}
+	w, err := wiegand.NewWriter(wiegand.WriterConfig{D0: d0, D1: d1})
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if d0.closed || d1.closed {
+		t.Error("Close() closed pins passed in WriterConfig, want them left to the caller")
+	}
+}